@@ -1,13 +1,31 @@
 package main
 
 import (
+	"math"
+
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
+type PlaybackMode int
+
+const (
+	PlaybackLoop PlaybackMode = iota
+	PlaybackOnce
+	PlaybackPingPong
+	PlaybackReverse
+)
+
 type Animation struct {
 	keyframes     []*ebiten.Image
 	current_frame int
 	delay         int
+	durations     []int // per frame delays, overriding delay when set
+	mode          PlaybackMode
+	speed         float64
+	elapsed       float64 // ticks spent on the current frame
+	time          float64 // ticks spent in the current cycle
+	direction     int
+	finished      bool
 }
 
 func NewAnimation(keyframes []*ebiten.Image, delay int) *Animation {
@@ -15,11 +33,149 @@ func NewAnimation(keyframes []*ebiten.Image, delay int) *Animation {
 		keyframes:     keyframes,
 		current_frame: 0,
 		delay:         delay,
+		mode:          PlaybackLoop,
+		speed:         1,
+		direction:     1,
 	}
 }
 
+func NewTimedAnimation(keyframes []*ebiten.Image, durations []int) *Animation {
+	a := NewAnimation(keyframes, durations[0])
+	a.durations = durations
+	return a
+}
+
+// A one-shot animation stops on its last frame instead of looping.
+func NewOneShotAnimation(keyframes []*ebiten.Image, delay int) *Animation {
+	return NewAnimation(keyframes, delay).SetMode(PlaybackOnce)
+}
+
+func (a *Animation) SetMode(mode PlaybackMode) *Animation {
+	a.mode = mode
+	a.Reset()
+	return a
+}
+
+// Scales the playback rate, 2 plays twice as fast, 0 pauses.
+func (a *Animation) SetSpeed(speed float64) *Animation {
+	a.speed = speed
+	return a
+}
+
+// Advances the timers by one tick and returns true when the current frame
+// ran out and Step should be called, possibly several times at high speeds.
+func (a *Animation) Tick() bool {
+	if a.finished {
+		return false
+	}
+	a.elapsed += a.speed
+	a.time += a.speed
+	return a.Due()
+}
+
+func (a *Animation) Due() bool {
+	return !a.finished && a.elapsed >= float64(a.FrameDelay())
+}
+
 func (a *Animation) Step() *ebiten.Image {
-	a.current_frame = (a.current_frame + 1) % len(a.keyframes)
+	n := len(a.keyframes)
+	a.elapsed -= float64(a.FrameDelay())
+	if a.elapsed < 0 {
+		a.elapsed = 0
+	}
+
+	wrapped := false
+	switch a.mode {
+	case PlaybackLoop:
+		a.current_frame = (a.current_frame + 1) % n
+		wrapped = a.current_frame == 0
+	case PlaybackOnce:
+		if a.current_frame == n-1 {
+			a.finished = true
+		} else {
+			a.current_frame++
+		}
+	case PlaybackReverse:
+		a.current_frame = (a.current_frame - 1 + n) % n
+		wrapped = a.current_frame == n-1
+	case PlaybackPingPong:
+		if n > 1 {
+			if a.current_frame+a.direction < 0 || a.current_frame+a.direction >= n {
+				a.direction = -a.direction
+			}
+			a.current_frame += a.direction
+			wrapped = a.current_frame == 0
+		}
+	}
+
+	if wrapped {
+		a.time = a.elapsed
+	}
+	return a.keyframes[a.current_frame]
+}
+
+func (a *Animation) Reset() {
+	a.current_frame = 0
+	if a.mode == PlaybackReverse {
+		a.current_frame = len(a.keyframes) - 1
+	}
+	a.direction = 1
+	a.elapsed = 0
+	a.time = 0
+	a.finished = false
+}
+
+func (a *Animation) FrameDelay() int {
+	if a.durations != nil {
+		return a.durations[a.current_frame]
+	}
+	return a.delay
+}
+
+// Total length of one run through all frames, in ticks.
+func (a *Animation) Length() int {
+	if a.durations == nil {
+		return a.delay * len(a.keyframes)
+	}
+	total := 0
+	for _, d := range a.durations {
+		total += d
+	}
+	return total
+}
+
+// Length of a full cycle, ping-pong plays the inner frames twice.
+func (a *Animation) CycleLength() int {
+	length := a.Length()
+	n := len(a.keyframes)
+	if a.mode == PlaybackPingPong && n > 1 {
+		first, last := a.delay, a.delay
+		if a.durations != nil {
+			first, last = a.durations[0], a.durations[n-1]
+		}
+		length = 2*length - first - last
+	}
+	return length
+}
+
+// How far through the current cycle playback is, from 0 to 1. Finished
+// one-shot animations report 1.
+func (a *Animation) Progress() float64 {
+	if a.finished {
+		return 1
+	}
+	length := a.CycleLength()
+	if length == 0 {
+		return 0
+	}
+	return math.Min(a.time/float64(length), 1)
+}
+
+func (a *Animation) Finished() bool {
+	return a.finished
+}
+
+func (a *Animation) Frame() *ebiten.Image {
 	return a.keyframes[a.current_frame]
 }
 
@@ -33,28 +189,60 @@ const (
 	PlayerTakingDamage
 )
 
+type animation_transition struct {
+	keep_frame bool
+}
+
+// Animator is a small state machine over animations. Without declared
+// transitions any animation can follow any other, once a transition is
+// declared from a state only the declared ones are allowed from it.
 type Animator[T ~int] struct {
-	target     **ebiten.Image
-	animations map[T]*Animation
-	ckey       T
-	animation  *Animation
-	elapsed    int
+	target       **ebiten.Image
+	animations   map[T]*Animation
+	ckey         T
+	animation    *Animation
+	transitions  map[T]map[T]animation_transition
+	next         map[T]T
+	on_complete  map[T][]func()
+	frame_events map[T]map[int][]func()
 }
 
 func NewAnimator[T ~int](target **ebiten.Image) *Animator[T] {
 	return &Animator[T]{
-		target:     target,
-		animations: map[T]*Animation{},
-		ckey:       0,
-		animation:  nil,
-		elapsed:    0,
+		target:       target,
+		animations:   map[T]*Animation{},
+		ckey:         0,
+		animation:    nil,
+		transitions:  map[T]map[T]animation_transition{},
+		next:         map[T]T{},
+		on_complete:  map[T][]func(){},
+		frame_events: map[T]map[int][]func(){},
 	}
 }
 
 func (a *Animator[T]) Update() {
-	a.elapsed = (a.elapsed + 1) % a.animation.delay
-	if a.elapsed == 0 {
+	if !a.animation.Tick() {
+		return
+	}
+
+	for a.animation.Due() {
+		frame := a.animation.current_frame
 		*a.target = a.animation.Step()
+		if a.animation.current_frame != frame {
+			a.fireFrame(a.ckey, a.animation.current_frame)
+		}
+
+		if a.animation.finished {
+			key := a.ckey
+			for _, callback := range a.on_complete[key] {
+				callback()
+			}
+			// callbacks may have already moved on to another animation
+			if next, ok := a.next[key]; ok && a.ckey == key {
+				a.Play(next)
+			}
+			return
+		}
 	}
 }
 
@@ -62,8 +250,103 @@ func (a *Animator[T]) AddAnimation(key T, animation *Animation) {
 	a.animations[key] = animation
 }
 
+// Forces the animation, restarting it at frame 0 even if already playing.
 func (a *Animator[T]) SetAnimation(key T) {
 	a.ckey = key
 	a.animation = a.animations[key]
-	a.animation.current_frame = 0
+	a.animation.Reset()
+	*a.target = a.animation.Frame()
+	a.fireFrame(key, a.animation.current_frame)
+}
+
+// Declares that from can change into to. With keep_frame the new animation
+// continues at the frame the old one was on, e.g. attacking while starting
+// to move.
+func (a *Animator[T]) AddTransition(from T, to T, keep_frame bool) {
+	if a.transitions[from] == nil {
+		a.transitions[from] = map[T]animation_transition{}
+	}
+	a.transitions[from][to] = animation_transition{keep_frame: keep_frame}
+}
+
+func (a *Animator[T]) CanPlay(key T) bool {
+	allowed, declared := a.transitions[a.ckey]
+	if !declared {
+		return true
+	}
+	_, ok := allowed[key]
+	return ok
+}
+
+// Switches to key if the transition is allowed. Playing the current
+// animation again does not restart it. Returns whether key is now playing.
+func (a *Animator[T]) Play(key T) bool {
+	if key == a.ckey && a.animation != nil {
+		return true
+	}
+	if !a.CanPlay(key) {
+		return false
+	}
+
+	transition := a.transitions[a.ckey][key]
+	if transition.keep_frame && a.animation != nil {
+		old := a.animation
+		a.ckey = key
+		a.animation = a.animations[key]
+		a.animation.Reset()
+		a.animation.current_frame = old.current_frame % len(a.animation.keyframes)
+		a.animation.direction = old.direction
+		a.animation.elapsed = old.elapsed
+		a.animation.time = old.time
+		*a.target = a.animation.Frame()
+		return true
+	}
+
+	a.SetAnimation(key)
+	return true
+}
+
+// Plays next once the one-shot animation key finished.
+func (a *Animator[T]) Then(key T, next T) {
+	a.next[key] = next
+}
+
+func (a *Animator[T]) OnComplete(key T, callback func()) {
+	a.on_complete[key] = append(a.on_complete[key], callback)
+}
+
+// Calls callback whenever the animation key reaches frame.
+func (a *Animator[T]) OnFrame(key T, frame int, callback func()) {
+	if a.frame_events[key] == nil {
+		a.frame_events[key] = map[int][]func(){}
+	}
+	a.frame_events[key][frame] = append(a.frame_events[key][frame], callback)
+}
+
+func (a *Animator[T]) Current() T {
+	return a.ckey
+}
+
+func (a *Animator[T]) Finished() bool {
+	return a.animation != nil && a.animation.finished
+}
+
+func (a *Animator[T]) Progress() float64 {
+	if a.animation == nil {
+		return 0
+	}
+	return a.animation.Progress()
+}
+
+// Scales the playback rate of every animation of the animator.
+func (a *Animator[T]) SetSpeed(speed float64) {
+	for _, animation := range a.animations {
+		animation.SetSpeed(speed)
+	}
+}
+
+func (a *Animator[T]) fireFrame(key T, frame int) {
+	for _, callback := range a.frame_events[key][frame] {
+		callback()
+	}
 }
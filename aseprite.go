@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strconv"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Reader for the .aseprite/.ase format, see
+// https://github.com/aseprite/aseprite/blob/main/docs/ase-file-specs.md
+// Visible layers are flattened with normal blending, every frame becomes
+// one image.
+
+const (
+	ase_magic       = 0xA5E0
+	ase_frame_magic = 0xF1FA
+
+	ase_chunk_old_palette = 0x0004
+	ase_chunk_layer       = 0x2004
+	ase_chunk_cel         = 0x2005
+	ase_chunk_tags        = 0x2018
+	ase_chunk_palette     = 0x2019
+
+	ase_cel_raw        = 0
+	ase_cel_linked     = 1
+	ase_cel_compressed = 2
+
+	ase_layer_visible = 1
+	ase_layer_group   = 1
+)
+
+var ase_directions = [4]string{"forward", "reverse", "pingpong", "pingpong_reverse"}
+
+type AsepriteTag struct {
+	name      string
+	from      int
+	to        int
+	direction string
+}
+
+type AsepriteFile struct {
+	width     int
+	height    int
+	frames    []*image.NRGBA
+	durations []int // milliseconds
+	tags      []AsepriteTag
+}
+
+type ase_layer struct {
+	name    string
+	visible bool
+	group   bool
+	level   int
+	opacity uint8
+}
+
+type ase_cel struct {
+	layer   int
+	x       int
+	y       int
+	opacity uint8
+	image   *image.NRGBA
+}
+
+type ase_reader struct {
+	r   io.Reader
+	err error
+}
+
+func (a *ase_reader) read(v interface{}) {
+	if a.err == nil {
+		a.err = binary.Read(a.r, binary.LittleEndian, v)
+	}
+}
+
+func (a *ase_reader) u8() uint8 {
+	var v uint8
+	a.read(&v)
+	return v
+}
+
+func (a *ase_reader) u16() uint16 {
+	var v uint16
+	a.read(&v)
+	return v
+}
+
+func (a *ase_reader) i16() int16 {
+	var v int16
+	a.read(&v)
+	return v
+}
+
+func (a *ase_reader) u32() uint32 {
+	var v uint32
+	a.read(&v)
+	return v
+}
+
+func (a *ase_reader) skip(n int) {
+	if a.err == nil {
+		_, a.err = io.CopyN(io.Discard, a.r, int64(n))
+	}
+}
+
+func (a *ase_reader) str() string {
+	n := a.u16()
+	buf := make([]byte, n)
+	a.read(buf)
+	return string(buf)
+}
+
+func ParseAseprite(r io.Reader) (*AsepriteFile, error) {
+	h := &ase_reader{r: r}
+
+	h.u32() // file size
+	if magic := h.u16(); h.err == nil && magic != ase_magic {
+		return nil, errors.New("aseprite: bad magic number")
+	}
+	frame_count := int(h.u16())
+	width := int(h.u16())
+	height := int(h.u16())
+	depth := int(h.u16())
+	flags := h.u32()
+	h.skip(2 + 4 + 4) // speed, reserved
+	transparent := h.u8()
+	h.skip(3 + 2 + 1 + 1 + 2 + 2 + 2 + 2 + 84)
+	if h.err != nil {
+		return nil, fmt.Errorf("aseprite: header: %w", h.err)
+	}
+	if depth != 32 && depth != 16 && depth != 8 {
+		return nil, fmt.Errorf("aseprite: unsupported color depth %d", depth)
+	}
+	layer_opacity := flags&1 != 0
+
+	file := &AsepriteFile{width: width, height: height}
+	layers := []ase_layer{}
+	palette := make([]color.NRGBA, 256)
+	cels := make([][]ase_cel, frame_count)
+
+	for f := 0; f < frame_count; f++ {
+		h.u32() // bytes in frame
+		if magic := h.u16(); h.err == nil && magic != ase_frame_magic {
+			return nil, fmt.Errorf("aseprite: frame %d: bad magic number", f)
+		}
+		chunks := int(h.u16())
+		file.durations = append(file.durations, int(h.u16()))
+		h.skip(2)
+		if n := h.u32(); n != 0 {
+			chunks = int(n)
+		}
+		if h.err != nil {
+			return nil, fmt.Errorf("aseprite: frame %d: %w", f, h.err)
+		}
+
+		for c := 0; c < chunks; c++ {
+			size := h.u32()
+			kind := h.u16()
+			if h.err != nil {
+				return nil, fmt.Errorf("aseprite: frame %d: %w", f, h.err)
+			}
+			if size < 6 {
+				return nil, fmt.Errorf("aseprite: frame %d: bad chunk size", f)
+			}
+			data := make([]byte, size-6)
+			h.read(data)
+			if h.err != nil {
+				return nil, fmt.Errorf("aseprite: frame %d: %w", f, h.err)
+			}
+			ch := &ase_reader{r: bytes.NewReader(data)}
+
+			switch kind {
+			case ase_chunk_layer:
+				layers = append(layers, parseAseLayer(ch, layer_opacity))
+			case ase_chunk_cel:
+				cel, linked, err := parseAseCel(ch, depth, palette, transparent)
+				if err != nil {
+					return nil, fmt.Errorf("aseprite: frame %d: %w", f, err)
+				}
+				if linked >= 0 {
+					// linked cels reuse the cel of the same layer in another frame
+					if linked >= f {
+						return nil, fmt.Errorf("aseprite: frame %d: bad linked cel", f)
+					}
+					for _, other := range cels[linked] {
+						if other.layer == cel.layer {
+							cels[f] = append(cels[f], other)
+						}
+					}
+				} else if cel.image != nil {
+					cels[f] = append(cels[f], cel)
+				}
+			case ase_chunk_tags:
+				file.tags = append(file.tags, parseAseTags(ch)...)
+			case ase_chunk_palette:
+				parseAsePalette(ch, palette)
+			case ase_chunk_old_palette:
+				parseAseOldPalette(ch, palette)
+			}
+			if ch.err != nil {
+				return nil, fmt.Errorf("aseprite: frame %d: chunk %#x: %w", f, kind, ch.err)
+			}
+		}
+	}
+
+	visible := aseVisibleLayers(layers)
+	for f := 0; f < frame_count; f++ {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		// cels are drawn in layer order, bottom to top
+		for l := range layers {
+			if !visible[l] {
+				continue
+			}
+			for _, cel := range cels[f] {
+				if cel.layer != l {
+					continue
+				}
+				alpha := uint8(uint16(cel.opacity) * uint16(layers[l].opacity) / 255)
+				r := cel.image.Bounds().Add(image.Pt(cel.x, cel.y))
+				draw.DrawMask(img, r, cel.image, image.Point{}, image.NewUniform(color.Alpha{alpha}), image.Point{}, draw.Over)
+			}
+		}
+		file.frames = append(file.frames, img)
+	}
+
+	return file, nil
+}
+
+// A layer is only drawn if it and all groups it is nested in are visible.
+func aseVisibleLayers(layers []ase_layer) []bool {
+	visible := make([]bool, len(layers))
+	parents := []bool{}
+	for i, l := range layers {
+		if l.level < len(parents) {
+			parents = parents[:l.level]
+		}
+		v := l.visible
+		for _, p := range parents {
+			v = v && p
+		}
+		visible[i] = v && !l.group
+		if l.group {
+			parents = append(parents, l.visible)
+		}
+	}
+	return visible
+}
+
+func parseAseLayer(h *ase_reader, use_opacity bool) ase_layer {
+	flags := h.u16()
+	kind := h.u16()
+	level := h.u16()
+	h.skip(2 + 2 + 2) // default size, blend mode
+	opacity := h.u8()
+	h.skip(3)
+	name := h.str()
+	if !use_opacity {
+		opacity = 255
+	}
+	return ase_layer{
+		name:    name,
+		visible: flags&ase_layer_visible != 0,
+		group:   kind == ase_layer_group,
+		level:   int(level),
+		opacity: opacity,
+	}
+}
+
+// Returns the cel, or the frame it links to when it is a linked cel.
+func parseAseCel(h *ase_reader, depth int, palette []color.NRGBA, transparent uint8) (ase_cel, int, error) {
+	cel := ase_cel{
+		layer: int(h.u16()),
+		x:     int(h.i16()),
+		y:     int(h.i16()),
+	}
+	cel.opacity = h.u8()
+	kind := h.u16()
+	h.skip(2 + 5) // z-index, reserved
+
+	switch kind {
+	case ase_cel_linked:
+		return cel, int(h.u16()), h.err
+	case ase_cel_raw, ase_cel_compressed:
+		w := int(h.u16())
+		hgt := int(h.u16())
+		if h.err != nil {
+			return cel, -1, h.err
+		}
+		var pixels io.Reader = h.r
+		if kind == ase_cel_compressed {
+			z, err := zlib.NewReader(h.r)
+			if err != nil {
+				return cel, -1, err
+			}
+			defer z.Close()
+			pixels = z
+		}
+		img, err := decodeAsePixels(pixels, w, hgt, depth, palette, transparent)
+		cel.image = img
+		return cel, -1, err
+	}
+	// tilemaps and future cel types are skipped
+	return cel, -1, nil
+}
+
+func decodeAsePixels(r io.Reader, w int, h int, depth int, palette []color.NRGBA, transparent uint8) (*image.NRGBA, error) {
+	bpp := depth / 8
+	buf := make([]byte, w*h*bpp)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		var c color.NRGBA
+		switch depth {
+		case 32:
+			c = color.NRGBA{buf[i*4], buf[i*4+1], buf[i*4+2], buf[i*4+3]}
+		case 16:
+			c = color.NRGBA{buf[i*2], buf[i*2], buf[i*2], buf[i*2+1]}
+		case 8:
+			if buf[i] != transparent {
+				c = palette[buf[i]]
+			}
+		}
+		img.SetNRGBA(i%w, i/w, c)
+	}
+	return img, nil
+}
+
+func parseAseTags(h *ase_reader) []AsepriteTag {
+	n := int(h.u16())
+	h.skip(8)
+	tags := []AsepriteTag{}
+	for i := 0; i < n && h.err == nil; i++ {
+		from := int(h.u16())
+		to := int(h.u16())
+		dir := int(h.u8())
+		h.skip(2 + 6 + 3 + 1) // repeat, reserved, deprecated color
+		name := h.str()
+		direction := "forward"
+		if dir < len(ase_directions) {
+			direction = ase_directions[dir]
+		}
+		tags = append(tags, AsepriteTag{name: name, from: from, to: to, direction: direction})
+	}
+	return tags
+}
+
+func parseAsePalette(h *ase_reader, palette []color.NRGBA) {
+	h.u32() // new palette size
+	first := int(h.u32())
+	last := int(h.u32())
+	h.skip(8)
+	for i := first; i <= last && h.err == nil; i++ {
+		flags := h.u16()
+		c := color.NRGBA{h.u8(), h.u8(), h.u8(), h.u8()}
+		if flags&1 != 0 {
+			h.str()
+		}
+		if i < len(palette) {
+			palette[i] = c
+		}
+	}
+}
+
+func parseAseOldPalette(h *ase_reader, palette []color.NRGBA) {
+	packets := int(h.u16())
+	index := 0
+	for p := 0; p < packets && h.err == nil; p++ {
+		index += int(h.u8())
+		n := int(h.u8())
+		if n == 0 {
+			n = 256
+		}
+		for i := 0; i < n && h.err == nil; i++ {
+			c := color.NRGBA{h.u8(), h.u8(), h.u8(), 255}
+			if index < len(palette) {
+				palette[index] = c
+			}
+			index++
+		}
+	}
+}
+
+// Lays the frames out in a single row, so the file can be used like any
+// other sprite sheet.
+func (a *AsepriteFile) Atlas() *image.NRGBA {
+	atlas := image.NewNRGBA(image.Rect(0, 0, a.width*len(a.frames), a.height))
+	for i, frame := range a.frames {
+		r := image.Rect(i*a.width, 0, (i+1)*a.width, a.height)
+		draw.Draw(atlas, r, frame, image.Point{}, draw.Src)
+	}
+	return atlas
+}
+
+func NewSpriteSheetFromAseprite(key string, file *AsepriteFile) *SpriteSheet {
+	atlas := ebiten.NewImageFromImage(file.Atlas())
+	s := &SpriteSheet{
+		image:  atlas,
+		frames: make([]SheetFrame, 0, len(file.frames)),
+		names:  map[string]int{},
+		tags:   map[string]SheetTag{},
+	}
+
+	for i := range file.frames {
+		name := key + "_" + strconv.Itoa(i)
+		r := image.Rect(i*file.width, 0, (i+1)*file.width, file.height)
+		s.frames = append(s.frames, SheetFrame{
+			name:     name,
+			image:    atlas.SubImage(r).(*ebiten.Image),
+			duration: file.durations[i],
+		})
+		s.names[name] = i
+	}
+
+	for _, t := range file.tags {
+		if t.from < 0 || t.to >= len(s.frames) || t.from > t.to {
+			continue
+		}
+		s.tags[t.name] = SheetTag{name: t.name, from: t.from, to: t.to, direction: t.direction}
+	}
+	return s
+}
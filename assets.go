@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/zip"
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The resources the binary ships with, everything else is optional.
+//
+//go:embed res/*.png res/*.json res/data/*.json res/audio/*.wav res/shaders/*.kage
+var embedded_assets embed.FS
+
+// Packs are plain zip archives of the res directory, see build_lin.sh.
+const AssetPackName = "assets.pak"
+const ModsDirName = "mods"
+
+// LayeredFS looks files up in every layer in order, the first layer that
+// has a file wins. Directory listings are merged.
+type LayeredFS struct {
+	layers []fs.FS
+}
+
+func NewLayeredFS(layers ...fs.FS) *LayeredFS {
+	return &LayeredFS{layers: layers}
+}
+
+func (l *LayeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l.layers {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (l *LayeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	entries := []fs.DirEntry{}
+	found := false
+	for _, layer := range l.layers {
+		layer_entries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, entry := range layer_entries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Builds the resource file system, from highest to lowest priority: the
+// mods directory, the asset pack and the embedded resources. Empty paths
+// fall back to the default names next to the executable and are skipped
+// when they dont exist there.
+func OpenAssets(mods_dir string, pack_path string) (*LayeredFS, error) {
+	layers := []fs.FS{}
+
+	if mods_dir == "" {
+		mods_dir = besideExecutable(ModsDirName)
+	} else if _, err := os.Stat(mods_dir); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(mods_dir); err == nil && info.IsDir() {
+		layers = append(layers, os.DirFS(mods_dir))
+	}
+
+	if pack_path == "" {
+		pack_path = besideExecutable(AssetPackName)
+		if _, err := os.Stat(pack_path); err != nil {
+			pack_path = ""
+		}
+	}
+	if pack_path != "" {
+		// stays open for as long as the game runs
+		pack, err := zip.OpenReader(pack_path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, pack)
+	}
+
+	res, err := fs.Sub(embedded_assets, "res")
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, res)
+	return NewLayeredFS(layers...), nil
+}
+
+func besideExecutable(name string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(filepath.Dir(exe), name)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"math/rand"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
+)
+
+const bytes_per_frame = 4 // 16 bit stereo
+
+type SoundDef struct {
+	path            string
+	volume          float64
+	max_voices      int     // the oldest voice is cut off beyond this
+	pitch_variation float64 // fraction the playback rate is randomly off by
+	priority        int     // higher priorities win once MaxVoices are playing
+}
+
+var sound_defs = map[string]*SoundDef{
+	"shoot":       {path: "audio/shoot.wav", volume: 0.35, max_voices: 4, pitch_variation: 0.08, priority: 2},
+	"hit":         {path: "audio/hit.wav", volume: 0.5, max_voices: 6, pitch_variation: 0.15, priority: 1},
+	"enemy_death": {path: "audio/enemy_death.wav", volume: 0.5, max_voices: 5, pitch_variation: 0.12, priority: 1},
+	"level_up":    {path: "audio/level_up.wav", volume: 0.7, max_voices: 1, priority: 10},
+}
+
+// Voice is one playing sound effect. Without an audio context there is no
+// player, voices still run for as long as the sound would have.
+type Voice struct {
+	sound      string
+	volume     float64
+	priority   int
+	positional bool
+	pos        Vector2
+	gain       float64 // attenuation by distance
+	pan        float64
+	player     *audio.Player
+	panner     *panner
+	ends       int // tick at which the sound is over
+}
+
+func (v *Voice) Playing(tick int) bool {
+	if v.player != nil {
+		return v.player.IsPlaying()
+	}
+	return tick < v.ends
+}
+
+func (v *Voice) Stop() {
+	if v.player != nil {
+		v.player.Pause()
+		v.player.Close()
+	}
+}
+
+// AudioManager mixes sound effects and the background music. A nil context
+// keeps all the bookkeeping without making any sound, for headless runs.
+type AudioManager struct {
+	context       *audio.Context
+	resources     *ResourceManager
+	voices        []*Voice
+	acquired      map[string]bool // clips loaded on demand, released by Close
+	tick          int
+	music         *audio.Player
+	music_path    string
+	master_volume float64
+	music_volume  float64
+	sfx_volume    float64
+}
+
+func NewAudioManager(context *audio.Context, resources *ResourceManager) *AudioManager {
+	return &AudioManager{
+		context:       context,
+		resources:     resources,
+		voices:        []*Voice{},
+		acquired:      map[string]bool{},
+		master_volume: 1,
+		music_volume:  0.5,
+		sfx_volume:    1,
+	}
+}
+
+func (a *AudioManager) Update() {
+	a.tick++
+	playing := a.voices[:0]
+	for _, voice := range a.voices {
+		if voice.Playing(a.tick) {
+			playing = append(playing, voice)
+		} else {
+			voice.Stop()
+		}
+	}
+	a.voices = playing
+	a.updateSpatial()
+}
+
+// Plays a sound effect from sound_defs, unknown sounds are ignored.
+func (a *AudioManager) Play(sound string) *Voice {
+	return a.play(sound, 1, 0)
+}
+
+func (a *AudioManager) play(sound string, gain float64, pan float64) *Voice {
+	def, ok := sound_defs[sound]
+	if !ok {
+		return nil
+	}
+
+	clip := a.clip(def.path)
+	if clip == nil || len(clip.pcm) == 0 {
+		return nil
+	}
+
+	if def.max_voices > 0 && a.Playing(sound) >= def.max_voices {
+		a.stopOldest(sound)
+	}
+	if !a.claimVoice(def.priority) {
+		return nil
+	}
+
+	pcm := clip.pcm
+	if def.pitch_variation > 0 {
+		pcm = resample(pcm, 1+(rand.Float64()*2-1)*def.pitch_variation)
+	}
+
+	voice := &Voice{
+		sound:    sound,
+		volume:   def.volume,
+		priority: def.priority,
+		gain:     gain,
+		pan:      pan,
+		ends:     a.tick + len(pcm)/bytes_per_frame*FPS/SampleRate + 1,
+	}
+	if a.context != nil {
+		voice.panner = newPanner(bytes.NewReader(pcm))
+		voice.panner.SetPan(pan)
+		player, err := a.context.NewPlayer(voice.panner)
+		if err != nil {
+			return nil
+		}
+		voice.player = player
+		voice.player.SetVolume(a.sfxVolume(voice))
+		voice.player.Play()
+	}
+	a.voices = append(a.voices, voice)
+	return voice
+}
+
+// Clips that were not preloaded are loaded on first use and kept until
+// Close.
+func (a *AudioManager) clip(file_path string) *AudioClip {
+	if !a.resources.Loaded(file_path) {
+		if a.acquired[file_path] {
+			return nil
+		}
+		res, err := a.resources.Acquire(file_path)
+		if res != nil {
+			a.acquired[file_path] = true
+		}
+		if err != nil {
+			return nil
+		}
+	}
+	return GetResource[*AudioClip](a.resources, file_path)
+}
+
+// Stops everything and releases the clips loaded on demand.
+func (a *AudioManager) Close() {
+	for _, voice := range a.voices {
+		voice.Stop()
+	}
+	a.voices = a.voices[:0]
+	a.StopMusic()
+	for file_path := range a.acquired {
+		a.resources.Release(file_path)
+	}
+	a.acquired = map[string]bool{}
+}
+
+func (a *AudioManager) stopOldest(sound string) {
+	for i, voice := range a.voices {
+		if voice.sound == sound {
+			voice.Stop()
+			a.voices = append(a.voices[:i], a.voices[i+1:]...)
+			return
+		}
+	}
+}
+
+// How many voices of a sound are playing.
+func (a *AudioManager) Playing(sound string) int {
+	count := 0
+	for _, voice := range a.voices {
+		if voice.sound == sound {
+			count++
+		}
+	}
+	return count
+}
+
+func (a *AudioManager) Voices() int {
+	return len(a.voices)
+}
+
+// Streams looping music from an OGG or WAV file, replacing the current one.
+func (a *AudioManager) PlayMusic(file_path string) error {
+	if a.music_path == file_path {
+		return nil
+	}
+	a.StopMusic()
+	a.music_path = file_path
+	if a.context == nil {
+		return nil
+	}
+
+	data, err := fs.ReadFile(a.resources.fsys, file_path)
+	if err != nil {
+		return err
+	}
+	var stream interface {
+		io.ReadSeeker
+		Length() int64
+	}
+	if strings.HasSuffix(file_path, ".ogg") {
+		stream, err = vorbis.DecodeWithSampleRate(SampleRate, bytes.NewReader(data))
+	} else {
+		stream, err = wav.DecodeWithSampleRate(SampleRate, bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+
+	a.music, err = a.context.NewPlayer(audio.NewInfiniteLoop(stream, stream.Length()))
+	if err != nil {
+		return err
+	}
+	a.music.SetVolume(a.master_volume * a.music_volume)
+	a.music.Play()
+	return nil
+}
+
+func (a *AudioManager) StopMusic() {
+	if a.music != nil {
+		a.music.Pause()
+		a.music.Close()
+		a.music = nil
+	}
+	a.music_path = ""
+}
+
+func (a *AudioManager) MusicPath() string {
+	return a.music_path
+}
+
+// Volumes go from 0 to 1 and apply to whatever is already playing.
+func (a *AudioManager) SetMasterVolume(volume float64) {
+	a.master_volume = clampVolume(volume)
+	a.applyVolumes()
+}
+
+func (a *AudioManager) SetMusicVolume(volume float64) {
+	a.music_volume = clampVolume(volume)
+	a.applyVolumes()
+}
+
+func (a *AudioManager) SetSFXVolume(volume float64) {
+	a.sfx_volume = clampVolume(volume)
+	a.applyVolumes()
+}
+
+func (a *AudioManager) applyVolumes() {
+	if a.music != nil {
+		a.music.SetVolume(a.master_volume * a.music_volume)
+	}
+	for _, voice := range a.voices {
+		if voice.player != nil {
+			voice.player.SetVolume(a.sfxVolume(voice))
+		}
+	}
+}
+
+func (a *AudioManager) sfxVolume(voice *Voice) float64 {
+	return a.master_volume * a.sfx_volume * voice.volume * voice.gain
+}
+
+func clampVolume(volume float64) float64 {
+	if volume < 0 {
+		return 0
+	}
+	if volume > 1 {
+		return 1
+	}
+	return volume
+}
+
+// Plays pcm back at rate times the speed, which also shifts the pitch.
+// Frames in between samples are linearly interpolated.
+func resample(pcm []byte, rate float64) []byte {
+	frames := len(pcm) / bytes_per_frame
+	out_frames := int(float64(frames) / rate)
+	out := make([]byte, out_frames*bytes_per_frame)
+	sample := func(frame int, channel int) float64 {
+		i := frame*bytes_per_frame + channel*2
+		return float64(int16(uint16(pcm[i]) | uint16(pcm[i+1])<<8))
+	}
+	for f := 0; f < out_frames; f++ {
+		pos := float64(f) * rate
+		i := int(pos)
+		t := pos - float64(i)
+		j := i + 1
+		if j >= frames {
+			j = frames - 1
+		}
+		for c := 0; c < 2; c++ {
+			v := int16(sample(i, c)*(1-t) + sample(j, c)*t)
+			o := f*bytes_per_frame + c*2
+			out[o] = byte(v)
+			out[o+1] = byte(uint16(v) >> 8)
+		}
+	}
+	return out
+}
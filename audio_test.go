@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// An audio manager without a context, over the sounds in res/audio.
+func newTestAudioManager(t *testing.T) *AudioManager {
+	t.Helper()
+	resources := NewResourceManager(os.DirFS("res"))
+	paths := []string{}
+	for _, def := range sound_defs {
+		paths = append(paths, def.path)
+	}
+	resources.Preload(paths)
+	resources.Wait()
+	if errs := resources.Fallbacks(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return NewAudioManager(nil, resources)
+}
+
+// Registers a sound for the length of the test.
+func addTestSound(t *testing.T, name string, def *SoundDef) {
+	t.Helper()
+	sound_defs[name] = def
+	t.Cleanup(func() {
+		delete(sound_defs, name)
+	})
+}
+
+func TestAudioUnknownSound(t *testing.T) {
+	a := newTestAudioManager(t)
+	if voice := a.Play("nope"); voice != nil {
+		t.Errorf("unknown sound got a voice")
+	}
+	if a.Voices() != 0 {
+		t.Errorf("voices = %d, want 0", a.Voices())
+	}
+}
+
+func TestAudioVoicesEnd(t *testing.T) {
+	a := newTestAudioManager(t)
+	last := 0
+	for _, sound := range []string{"shoot", "hit", "enemy_death", "level_up"} {
+		voice := a.Play(sound)
+		if voice == nil {
+			t.Fatalf("%s did not play", sound)
+		}
+		if voice.ends > last {
+			last = voice.ends
+		}
+	}
+	if a.Voices() != 4 {
+		t.Fatalf("voices = %d, want 4", a.Voices())
+	}
+
+	for a.tick < last-1 {
+		a.Update()
+	}
+	if a.Voices() == 0 {
+		t.Errorf("every voice ended before the longest sound was over")
+	}
+	a.Update()
+	if a.Voices() != 0 {
+		t.Errorf("voices = %d after every sound was over, want 0", a.Voices())
+	}
+}
+
+func TestAudioSoundVoiceLimit(t *testing.T) {
+	a := newTestAudioManager(t)
+	def := sound_defs["shoot"]
+	voices := []*Voice{}
+	for i := 0; i < def.max_voices+3; i++ {
+		voices = append(voices, a.Play("shoot"))
+	}
+	if a.Playing("shoot") != def.max_voices {
+		t.Errorf("playing = %d, want %d", a.Playing("shoot"), def.max_voices)
+	}
+	// the oldest voices were cut off for the new ones
+	for _, voice := range a.voices {
+		if voice == voices[0] {
+			t.Errorf("the oldest voice is still playing")
+		}
+	}
+	if a.voices[len(a.voices)-1] != voices[len(voices)-1] {
+		t.Errorf("the newest voice is not playing")
+	}
+
+	a.Play("hit")
+	if a.Playing("hit") != 1 || a.Playing("shoot") != def.max_voices {
+		t.Errorf("the limit of one sound cut off another one")
+	}
+}
+
+func TestAudioMaxVoices(t *testing.T) {
+	a := newTestAudioManager(t)
+	addTestSound(t, "low", &SoundDef{path: "audio/hit.wav", volume: 1, priority: 0})
+	addTestSound(t, "high", &SoundDef{path: "audio/hit.wav", volume: 1, priority: 5})
+
+	for i := 0; i < MaxVoices+5; i++ {
+		a.Play("low")
+	}
+	if a.Voices() != MaxVoices {
+		t.Fatalf("voices = %d, want %d", a.Voices(), MaxVoices)
+	}
+
+	// a higher priority takes the place of a lower one
+	if a.Play("high") == nil {
+		t.Fatalf("higher priority sound did not play")
+	}
+	if a.Voices() != MaxVoices || a.Playing("low") != MaxVoices-1 {
+		t.Errorf("voices = %d, low = %d, want %d and %d", a.Voices(), a.Playing("low"), MaxVoices, MaxVoices-1)
+	}
+
+	for i := 0; i < MaxVoices; i++ {
+		a.Play("high")
+	}
+	// a lower priority does not
+	if a.Play("hit") != nil {
+		t.Errorf("lower priority sound played over higher ones")
+	}
+	if a.Playing("high") != MaxVoices {
+		t.Errorf("high = %d, want %d", a.Playing("high"), MaxVoices)
+	}
+}
+
+func TestAudioPitchVariation(t *testing.T) {
+	a := newTestAudioManager(t)
+	for _, sound := range []string{"shoot", "hit", "enemy_death", "level_up"} {
+		def := sound_defs[sound]
+		frames := len(a.clip(def.path).pcm) / bytes_per_frame
+		duration := func(rate float64) int {
+			return int(float64(frames)/rate)*FPS/SampleRate + 1
+		}
+		shortest := duration(1 + def.pitch_variation)
+		longest := duration(1 - def.pitch_variation)
+
+		for i := 0; i < 50; i++ {
+			voice := a.Play(sound)
+			if voice == nil {
+				t.Fatalf("%s did not play", sound)
+			}
+			d := voice.ends - a.tick
+			if d < shortest || d > longest {
+				t.Fatalf("%s lasts %d ticks, want %d to %d", sound, d, shortest, longest)
+			}
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	pcm := make([]byte, 1000*bytes_per_frame)
+	for f := 0; f < 1000; f++ {
+		for c := 0; c < 2; c++ {
+			v := int16(f * 10)
+			pcm[f*bytes_per_frame+c*2] = byte(v)
+			pcm[f*bytes_per_frame+c*2+1] = byte(uint16(v) >> 8)
+		}
+	}
+	for _, rate := range []float64{0.5, 0.92, 1, 1.15, 2} {
+		out := resample(pcm, rate)
+		if want := int(1000/rate) * bytes_per_frame; len(out) != want {
+			t.Errorf("rate %v: %d bytes, want %d", rate, len(out), want)
+		}
+	}
+	if out := resample(pcm, 1); string(out) != string(pcm) {
+		t.Errorf("rate 1 changed the samples")
+	}
+}
+
+func TestAudioVolumes(t *testing.T) {
+	a := newTestAudioManager(t)
+	if a.master_volume != 1 || a.music_volume != 0.5 || a.sfx_volume != 1 {
+		t.Errorf("default volumes = %v %v %v, want 1 0.5 1", a.master_volume, a.music_volume, a.sfx_volume)
+	}
+
+	a.SetMasterVolume(1.5)
+	a.SetMusicVolume(-0.2)
+	a.SetSFXVolume(0.25)
+	if a.master_volume != 1 || a.music_volume != 0 || a.sfx_volume != 0.25 {
+		t.Errorf("volumes = %v %v %v, want 1 0 0.25", a.master_volume, a.music_volume, a.sfx_volume)
+	}
+
+	a.SetMasterVolume(0.5)
+	voice := a.Play("level_up")
+	if voice == nil {
+		t.Fatalf("level_up did not play")
+	}
+	want := 0.5 * 0.25 * sound_defs["level_up"].volume
+	if got := a.sfxVolume(voice); got != want {
+		t.Errorf("sfx volume = %v, want %v", got, want)
+	}
+}
+
+func TestAudioCloseReleasesClips(t *testing.T) {
+	resources := NewResourceManager(os.DirFS("res"))
+	a := NewAudioManager(nil, resources)
+	if a.Play("shoot") == nil {
+		t.Fatalf("shoot did not play")
+	}
+	file_path := sound_defs["shoot"].path
+	if !resources.Loaded(file_path) {
+		t.Fatalf("the clip was not loaded on demand")
+	}
+	a.Play("shoot")
+
+	a.Close()
+	if resources.Loaded(file_path) {
+		t.Errorf("the clip is still loaded after Close")
+	}
+	if a.Voices() != 0 {
+		t.Errorf("voices = %d after Close, want 0", a.Voices())
+	}
+}
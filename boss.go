@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const BossSize = 96
+const BossHealth = 3000
+const BossXP = 500
+const boss_bar_width = 300
+const boss_bar_height = 8
+
+// BulletPattern fires every interval ticks, shot counts the firings so far
+// so patterns like spirals can rotate between them.
+type BulletPattern struct {
+	interval int
+	elapsed  int
+	shot     int
+	fire     func(b *Boss, shot int)
+}
+
+func (p *BulletPattern) Update(b *Boss) {
+	p.elapsed++
+	if p.elapsed >= p.interval {
+		p.elapsed = 0
+		p.fire(b, p.shot)
+		p.shot++
+	}
+}
+
+func RingPattern(interval int, count int, speed float64) *BulletPattern {
+	return &BulletPattern{
+		interval: interval,
+		fire: func(b *Boss, shot int) {
+			// every other ring is rotated by half a step to close the gaps
+			offset := float64(shot%2) * math.Pi / float64(count)
+			for i := 0; i < count; i++ {
+				angle := offset + 2*math.Pi*float64(i)/float64(count)
+				b.Fire(Vector2{math.Cos(angle), math.Sin(angle)}, speed)
+			}
+		},
+	}
+}
+
+func SpiralPattern(interval int, arms int, step float64, speed float64) *BulletPattern {
+	return &BulletPattern{
+		interval: interval,
+		fire: func(b *Boss, shot int) {
+			for i := 0; i < arms; i++ {
+				angle := float64(shot)*step + 2*math.Pi*float64(i)/float64(arms)
+				b.Fire(Vector2{math.Cos(angle), math.Sin(angle)}, speed)
+			}
+		},
+	}
+}
+
+// Fans count bullets over spread radians, centered on the player.
+func AimedBurstPattern(interval int, count int, spread float64, speed float64) *BulletPattern {
+	return &BulletPattern{
+		interval: interval,
+		fire: func(b *Boss, shot int) {
+			aim := b.target.Sub(b.cc.pos)
+			if aim.IsZero() {
+				return
+			}
+			aim = aim.Norm()
+			for i := 0; i < count; i++ {
+				angle := 0.0
+				if count > 1 {
+					angle = -spread/2 + spread*float64(i)/float64(count-1)
+				}
+				b.Fire(aim.Rotate(angle), speed)
+			}
+		},
+	}
+}
+
+type BossPhase struct {
+	threshold float64 // fraction of max health at which the phase starts
+	speed     float64
+	patterns  []*BulletPattern
+}
+
+type Boss struct {
+	name           string
+	cc             CircleCollider
+	health         int
+	max_health     int
+	phases         []BossPhase
+	phase          int
+	target         Vector2
+	sprite         *ebiten.Image
+	bullet_manager BulletManager
+	flash          int
+	removed        bool
+}
+
+func NewBoss(pos Vector2, tm *TextureManager) *Boss {
+	b := &Boss{
+		name:           "Ellen, Queen of the Horde",
+		cc:             CircleCollider{pos: pos.Add(Vector2{BossSize / 2, BossSize / 2}), r: BossSize / 2},
+		health:         BossHealth,
+		max_health:     BossHealth,
+		phase:          0,
+		sprite:         tm.GetTexture("mugshot"),
+		bullet_manager: *NewBulletManager(pos, SecondsToTicks(weapons["boss"].Lifetime), weapons["boss"].Velocity, weapons["boss"].Damage, tm),
+		phases: []BossPhase{
+			{
+				threshold: 1,
+				speed:     0.25,
+				patterns: []*BulletPattern{
+					RingPattern(1.5*FPS, 16, 1.2),
+					AimedBurstPattern(2*FPS, 5, math.Pi/6, 1.8),
+				},
+			},
+			{
+				threshold: 0.6,
+				speed:     0.35,
+				patterns: []*BulletPattern{
+					SpiralPattern(6, 3, 0.25, 1.4),
+					AimedBurstPattern(1.5*FPS, 5, math.Pi/5, 2),
+				},
+			},
+			{
+				threshold: 0.25,
+				speed:     0.5,
+				patterns: []*BulletPattern{
+					SpiralPattern(5, 4, -0.2, 1.5),
+					RingPattern(FPS, 24, 1.1),
+					AimedBurstPattern(1.2*FPS, 7, math.Pi/4, 2.2),
+				},
+			},
+		},
+	}
+	b.bullet_manager.hit = b.BulletHit
+	return b
+}
+
+func (b *Boss) Update() {
+	b.target = game.player.rect.pos.Add(game.player.rect.extents.Scale(0.5))
+
+	if b.Alive() {
+		phase := b.phases[b.phase]
+
+		dir := game.flow_field.Direction(b.cc.pos)
+		if dir.IsZero() {
+			dir = b.target.Sub(b.cc.pos)
+		}
+		// keep some distance, the patterns do the work
+		if !dir.IsZero() && b.cc.pos.Dist(b.target) > BossSize*1.5 {
+			rect := NewRect(b.cc.pos.Sub(Vector2{b.cc.r, b.cc.r}), Vector2{BossSize, BossSize})
+			game.world.MoveRect(&rect, dir.Norm().Scale(phase.speed))
+			b.cc.pos = rect.pos.Add(Vector2{b.cc.r, b.cc.r})
+		}
+
+		for _, pattern := range phase.patterns {
+			pattern.Update(b)
+		}
+	}
+
+	if b.flash > 0 {
+		b.flash--
+	}
+
+	b.bullet_manager.Update()
+
+	// linger until the last bullets are gone
+	if !b.Alive() && b.bullet_manager.bullets == nil {
+		b.removed = true
+	}
+}
+
+func (b *Boss) Fire(dir Vector2, speed float64) {
+	start := b.cc.pos.Sub(Vector2{BulletSize / 2, BulletSize / 2})
+	b.bullet_manager.Spawn(start, dir.Norm().Scale(speed))
+}
+
+func (b *Boss) TakeDamage(damage int) {
+	if !b.Alive() {
+		return
+	}
+	b.health -= damage
+	if b.health <= 0 {
+		b.health = 0
+		game.kills++
+		game.player.AddXP(BossXP)
+	}
+
+	// phases only ever advance, even if the threshold of several was crossed
+	ratio := float64(b.health) / float64(b.max_health)
+	for i := len(b.phases) - 1; i > b.phase; i-- {
+		if ratio <= b.phases[i].threshold {
+			b.phase = i
+			break
+		}
+	}
+}
+
+func (b *Boss) BulletHit(bullet *Bullet) bool {
+	if game.player.rect.Intersects(NewRect(bullet.pos, bullet.hitbox)) {
+		game.player.TakeDamage(bullet.damage)
+		return true
+	}
+	return false
+}
+
+func (b *Boss) Flash(ticks int) {
+	b.flash = ticks
+}
+
+func (b *Boss) Alive() bool {
+	return b.health > 0
+}
+
+func (b *Boss) Removed() bool {
+	return b.removed
+}
+
+func (b *Boss) Submit(q *RenderQueue, debug bool) {
+	b.bullet_manager.Submit(q, debug)
+	rect := NewRect(b.cc.pos.Sub(Vector2{BossSize / 2, BossSize / 2}), Vector2{BossSize, BossSize})
+	if b.Alive() && q.Cull(KindBoss, rect) {
+		q.Submit(LayerEntities, b.cc.pos.y+b.cc.r, b.sprite, func(screen *ebiten.Image) {
+			b.Draw(screen, debug)
+		})
+	}
+}
+
+func (b *Boss) Draw(screen *ebiten.Image, debug bool) {
+	sp := b.cc.pos.Sub(game.camera.rect.pos)
+	op := &ebiten.DrawImageOptions{}
+	w := float64(b.sprite.Bounds().Dx())
+	h := float64(b.sprite.Bounds().Dy())
+	op.GeoM.Scale(BossSize/w, BossSize/h)
+	op.GeoM.Translate(sp.x-BossSize/2, sp.y-BossSize/2)
+	DrawFlashing(screen, b.sprite, op, b.flash > 0)
+
+	if debug {
+		vector.StrokeCircle(screen, float32(sp.x), float32(sp.y), float32(b.cc.r), 1, color.RGBA{255, 0, 0, 255}, false)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("phase %d", b.phase+1), int(sp.x)-BossSize/2, int(sp.y)-BossSize/2-16)
+	}
+}
+
+// Drawn in screen space, along the top edge.
+func (b *Boss) DrawHealthBar(screen *ebiten.Image) {
+	if !b.Alive() {
+		return
+	}
+	sw := float32(screen.Bounds().Dx())
+	x := sw/2 - boss_bar_width/2
+	y := float32(24)
+	fill := float32(b.health) / float32(b.max_health) * boss_bar_width
+
+	vector.DrawFilledRect(screen, x-1, y-1, boss_bar_width+2, boss_bar_height+2, color.RGBA{0, 0, 0, 200}, false)
+	vector.DrawFilledRect(screen, x, y, fill, boss_bar_height, color.RGBA{200, 30, 60, 255}, false)
+	for _, phase := range b.phases[1:] {
+		mx := x + float32(phase.threshold)*boss_bar_width
+		vector.StrokeLine(screen, mx, y, mx, y+boss_bar_height, 1, color.RGBA{255, 255, 255, 180}, false)
+	}
+	ebitenutil.DebugPrintAt(screen, b.name, int(x), int(y)-16)
+}
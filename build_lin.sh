@@ -1,3 +1,9 @@
 #!/bin/sh
 GOOS=linux go build -o ./target/game .
-zip ./target/GameLin ./target/game ./res/*.png
+zip ./target/GameLin ./target/game
+
+# resources are embedded, the pack is only needed to ship updated assets,
+# build it with: ./build_lin.sh pak
+if [ "$1" = "pak" ]; then
+	(cd ./res && zip -r ../target/assets.pak ./*.png ./*.json ./data/*.json ./audio/*.wav ./shaders/*.kage)
+fi
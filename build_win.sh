@@ -1,3 +1,9 @@
 #!/bin/sh
 GOOS=windows go build -o ./target/game.exe .
-zip ./target/GameWin ./target/game.exe ./res/*.png
+zip ./target/GameWin ./target/game.exe
+
+# resources are embedded, the pack is only needed to ship updated assets,
+# build it with: ./build_win.sh pak
+if [ "$1" = "pak" ]; then
+	(cd ./res && zip -r ../target/assets.pak ./*.png ./*.json ./data/*.json ./audio/*.wav ./shaders/*.kage)
+fi
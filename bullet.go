@@ -11,6 +11,13 @@ import (
 const BulletSize = 16
 const BulletAnimationTimeout int = 0.1 * FPS
 
+type BulletState int
+
+const (
+	BulletFlying BulletState = iota
+	BulletDecaying
+)
+
 type BulletManager struct {
 	pos             Vector2
 	bullet_lifetime int
@@ -20,6 +27,8 @@ type BulletManager struct {
 	bullets         *Bullet
 	last            *Bullet
 	debug           *bool
+	// called for every live bullet, returns true when it hit something
+	hit func(b *Bullet) bool
 }
 
 func NewBulletManager(
@@ -40,8 +49,18 @@ func NewBulletManager(
 	}
 }
 
+func (bm *BulletManager) SetWeapon(w WeaponData) {
+	bm.bullet_lifetime = SecondsToTicks(w.Lifetime)
+	bm.bullet_velocity = w.Velocity
+	bm.bullet_damage = w.Damage
+}
+
 func (bm *BulletManager) Shoot(dir Vector2) {
-	b := NewBullet(bm.pos, dir.Norm().Scale(bm.bullet_velocity), bm.bullet_lifetime, bm.bullet_damage, bm.texture_manager)
+	bm.Spawn(bm.pos, dir.Norm().Scale(bm.bullet_velocity))
+}
+
+func (bm *BulletManager) Spawn(pos Vector2, vel Vector2) {
+	b := NewBullet(pos, vel, bm.bullet_lifetime, bm.bullet_damage, bm.texture_manager)
 
 	if bm.bullets == nil {
 		bm.bullets = b
@@ -61,12 +80,20 @@ func (bm *BulletManager) Update() {
 	for cb != nil {
 		cb.Update()
 
+		if !cb.Decaying() && bm.hit != nil && bm.hit(cb) {
+			cb.Hit()
+		}
+
 		if cb.Decayed() {
 			if pb != nil {
 				pb.next = cb.next
 			} else {
 				bm.bullets = cb.next
 			}
+			// hits take bullets out of order, new ones must not hang off a removed one
+			if cb == bm.last {
+				bm.last = pb
+			}
 		} else {
 			pb = cb
 		}
@@ -74,11 +101,25 @@ func (bm *BulletManager) Update() {
 	}
 }
 
-func (bm *BulletManager) Draw(screen *ebiten.Image, debug bool) {
-	cb := bm.bullets
-	for cb != nil {
-		cb.Draw(screen, debug)
-		cb = cb.next
+func (bm *BulletManager) Submit(q *RenderQueue, debug bool) {
+	for cb := bm.bullets; cb != nil; cb = cb.next {
+		b := cb
+		b.emitter.Submit(q)
+		if !q.Cull(KindBullet, NewRect(b.pos, b.hitbox)) {
+			continue
+		}
+		q.Submit(LayerProjectiles, b.pos.y, b.sprite, func(screen *ebiten.Image) {
+			b.Draw(screen, debug)
+		})
+	}
+}
+
+// Every bullet still flying glows in clr.
+func (bm *BulletManager) AddLights(l *Lighting, clr color.RGBA) {
+	for cb := bm.bullets; cb != nil; cb = cb.next {
+		if cb.lifetime > 0 {
+			l.Add(cb.pos.Add(cb.hitbox.Scale(0.5)), BulletLightRadius, clr)
+		}
 	}
 }
 
@@ -91,40 +132,23 @@ type Bullet struct {
 	damage     int
 	next       *Bullet
 	sprite     *ebiten.Image
-	animator   *Animator[int]
+	animator   *Animator[BulletState]
 	emitter    *ParticleEmitter
 	emit_task  *Task
 	moving     bool
 }
 
 func NewBullet(pos Vector2, vel Vector2, lifetime int, damage int, tm *TextureManager) *Bullet {
-	animation_sprites := []*ebiten.Image{
-		tm.GetTexture("bullet_pink0"),
-		tm.GetTexture("bullet_pink1"),
-		tm.GetTexture("bullet_pink2"),
-		tm.GetTexture("bullet_pink3"),
-		tm.GetTexture("bullet_pink4"),
-		tm.GetTexture("bullet_pink5"),
-		tm.GetTexture("bullet_pink6"),
-		tm.GetTexture("bullet_pink7"),
-	}
-
-	decay_spirtes := []*ebiten.Image{
-		tm.GetTexture("bullet_decay_0"),
-		tm.GetTexture("bullet_decay_1"),
-		tm.GetTexture("bullet_decay_2"),
-		tm.GetTexture("bullet_decay_3"),
-		tm.GetTexture("bullet_decay_4"),
-		tm.GetTexture("bullet_decay_5"),
-	}
+	flying := tm.GetAnimation("bullet_sheet", "flying")
+	decay := tm.GetAnimation("bullet_sheet", "decay").SetMode(PlaybackOnce)
 
 	b := &Bullet{
 		pos:        pos,
 		hitbox:     Vector2{float64(BulletSize), float64(BulletSize)},
 		vel:        vel,
 		lifetime:   lifetime,
-		decay_time: len(decay_spirtes) * BulletAnimationTimeout,
-		sprite:     animation_sprites[0],
+		decay_time: decay.Length(),
+		sprite:     flying.Frame(),
 		damage:     damage,
 		moving:     true,
 	}
@@ -135,17 +159,18 @@ func NewBullet(pos Vector2, vel Vector2, lifetime int, damage int, tm *TextureMa
 		b.emitter.Emit(b.vel.Scale(-0.25).Add(Vector2{0, vely}))
 	})
 
-	b.animator = NewAnimator[int](&b.sprite)
-	b.animator.AddAnimation(0, NewAnimation(animation_sprites, BulletAnimationTimeout))
-	b.animator.AddAnimation(1, NewAnimation(decay_spirtes, BulletAnimationTimeout))
-	b.animator.SetAnimation(0)
+	b.animator = NewAnimator[BulletState](&b.sprite)
+	b.animator.AddAnimation(BulletFlying, flying)
+	b.animator.AddAnimation(BulletDecaying, decay)
+	b.animator.AddTransition(BulletFlying, BulletDecaying, false)
+	b.animator.SetAnimation(BulletFlying)
 
 	return b
 }
 
 func (b *Bullet) Update() {
 	if b.StartedDecaying() {
-		b.animator.SetAnimation(1)
+		b.animator.Play(BulletDecaying)
 		b.vel.ScaleEq(0.5)
 		if !b.moving {
 			b.lifetime -= BulletAnimationTimeout
@@ -165,6 +190,16 @@ func (b *Bullet) Update() {
 	b.emitter.Update()
 }
 
+// Stops the bullet, it starts decaying on the next update.
+func (b *Bullet) Hit() {
+	b.lifetime = 0
+	b.moving = false
+}
+
+func (b *Bullet) Center() Vector2 {
+	return b.pos.Add(b.hitbox.Scale(0.5))
+}
+
 func (b *Bullet) Decaying() bool {
 	return b.lifetime < 0
 }
@@ -178,7 +213,6 @@ func (b *Bullet) Decayed() bool {
 }
 
 func (b *Bullet) Draw(screen *ebiten.Image, debug bool) {
-	b.emitter.Draw(screen)
 	op := &ebiten.DrawImageOptions{}
 	sp := b.pos.Sub(game.camera.rect.pos)
 	op.GeoM.Translate(sp.x, sp.y)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func newTestBulletManager(t *testing.T) *BulletManager {
+	t.Helper()
+	tm, err := NewTextureManager(NewResourceManager(os.DirFS("res")), "unknown.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.LoadTextures("."); err != nil {
+		t.Fatal(err)
+	}
+	return NewBulletManager(Vector2{0, 0}, 10*FPS, 1, 1, tm)
+}
+
+func bulletList(bm *BulletManager) []*Bullet {
+	bullets := []*Bullet{}
+	for b := bm.bullets; b != nil; b = b.next {
+		bullets = append(bullets, b)
+	}
+	return bullets
+}
+
+func TestBulletHitLastThenSpawn(t *testing.T) {
+	bm := newTestBulletManager(t)
+	for i := 0; i < 3; i++ {
+		bm.Shoot(Vector2{1, 0})
+	}
+	hit := bm.last
+	bm.hit = func(b *Bullet) bool {
+		return b == hit
+	}
+	for !hit.Decayed() {
+		bm.Update()
+	}
+	bm.hit = nil
+
+	if n := len(bulletList(bm)); n != 2 {
+		t.Fatalf("%d bullets after the hit, want 2", n)
+	}
+	bm.Shoot(Vector2{1, 0})
+	bullets := bulletList(bm)
+	if len(bullets) != 3 || bullets[2] != bm.last {
+		t.Fatalf("the new bullet can not be reached from the list")
+	}
+}
+
+func TestBulletListEmpties(t *testing.T) {
+	bm := newTestBulletManager(t)
+	for i := 0; i < 3; i++ {
+		bm.Shoot(Vector2{1, 0})
+	}
+	bm.hit = func(b *Bullet) bool {
+		return true
+	}
+	for i := 0; i < FPS && bm.bullets != nil; i++ {
+		bm.Update()
+	}
+	if bm.bullets != nil || bm.last != nil {
+		t.Fatalf("bullets left after every bullet decayed")
+	}
+
+	bm.hit = nil
+	bm.Shoot(Vector2{1, 0})
+	if bm.bullets == nil || bm.bullets != bm.last {
+		t.Fatalf("the first bullet after emptying is not the list")
+	}
+}
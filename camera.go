@@ -21,3 +21,11 @@ func (c *Camera) Update() {
 	c.rect.pos.x = c.tgt.x - c.rect.extents.x/2
 	c.rect.pos.y = c.tgt.y - c.rect.extents.y/2
 }
+
+func (c *Camera) ScreenToWorld(pos Vector2) Vector2 {
+	return pos.Add(c.rect.pos)
+}
+
+func (c *Camera) WorldToScreen(pos Vector2) Vector2 {
+	return pos.Sub(c.rect.pos)
+}
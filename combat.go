@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/colorm"
+)
+
+const CritChance = 0.1
+const CritMultiplier = 2
+const HitFlashTicks = 6
+const HitStopTicks = 5
+
+// Damageable is anything bullets can hit.
+type Damageable interface {
+	TakeDamage(damage int)
+	Flash(ticks int)
+	Alive() bool
+}
+
+type HitEvent struct {
+	target Damageable
+	pos    Vector2 // where the hit landed
+	damage int
+	crit   bool
+	killed bool
+}
+
+// CombatEvents applies damage and tells everyone interested about it, the
+// feedback of a hit (numbers, flashes, sounds) hangs off of here.
+type CombatEvents struct {
+	hit []func(e HitEvent)
+}
+
+func NewCombatEvents() *CombatEvents {
+	return &CombatEvents{hit: []func(e HitEvent){}}
+}
+
+func (c *CombatEvents) OnHit(listener func(e HitEvent)) {
+	c.hit = append(c.hit, listener)
+}
+
+// Deals damage to target, rolling for a critical hit first.
+func (c *CombatEvents) Hit(target Damageable, pos Vector2, damage int) HitEvent {
+	e := HitEvent{target: target, pos: pos, damage: damage}
+	if rand.Float64() < CritChance {
+		e.crit = true
+		e.damage *= CritMultiplier
+	}
+	target.TakeDamage(e.damage)
+	e.killed = !target.Alive()
+	for _, listener := range c.hit {
+		listener(e)
+	}
+	return e
+}
+
+// Draws img, or a white silhouette of it when flashing. The silhouette
+// keeps the alpha of op so fading sprites fade while flashing too.
+func DrawFlashing(screen *ebiten.Image, img *ebiten.Image, op *ebiten.DrawImageOptions, flashing bool) {
+	if !flashing {
+		screen.DrawImage(img, op)
+		return
+	}
+	var cm colorm.ColorM
+	cm.Scale(0, 0, 0, float64(op.ColorScale.A()))
+	cm.Translate(1, 1, 1, 0)
+	cop := &colorm.DrawImageOptions{}
+	cop.GeoM = op.GeoM
+	colorm.DrawImage(screen, img, cm, cop)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+)
+
+const DamageNumberLifetime = 0.8 * FPS
+
+type DamageNumber struct {
+	pos      Vector2
+	vel      Vector2
+	text     string
+	crit     bool
+	lifetime int
+}
+
+// DamageNumbers float up from where hits landed and fade out.
+type DamageNumbers struct {
+	numbers []*DamageNumber
+}
+
+func NewDamageNumbers() *DamageNumbers {
+	return &DamageNumbers{numbers: []*DamageNumber{}}
+}
+
+func (d *DamageNumbers) Spawn(pos Vector2, damage int, crit bool) {
+	n := &DamageNumber{
+		pos:      pos,
+		vel:      Vector2{(rand.Float64() - 0.5) * 0.4, -0.6},
+		text:     fmt.Sprint(damage),
+		crit:     crit,
+		lifetime: DamageNumberLifetime,
+	}
+	if crit {
+		n.text += "!"
+		n.vel.y *= 1.5
+	}
+	d.numbers = append(d.numbers, n)
+}
+
+func (d *DamageNumbers) Update() {
+	alive := d.numbers[:0]
+	for _, n := range d.numbers {
+		n.lifetime--
+		if n.lifetime <= 0 {
+			continue
+		}
+		n.pos.AddEq(n.vel)
+		n.vel = n.vel.Scale(0.97)
+		alive = append(alive, n)
+	}
+	d.numbers = alive
+}
+
+func (d *DamageNumbers) Draw(screen *ebiten.Image, face text.Face) {
+	for _, n := range d.numbers {
+		sp := n.pos.Sub(game.camera.rect.pos)
+		op := &text.DrawOptions{}
+		op.PrimaryAlign = text.AlignCenter
+		op.SecondaryAlign = text.AlignCenter
+		if n.crit {
+			op.GeoM.Scale(1.5, 1.5)
+			op.ColorScale.ScaleWithColor(color.RGBA{255, 220, 60, 255})
+		} else {
+			op.ColorScale.ScaleWithColor(color.White)
+		}
+		op.GeoM.Translate(sp.x, sp.y)
+		op.ColorScale.ScaleAlpha(float32(n.lifetime) / DamageNumberLifetime)
+		text.Draw(screen, n.text, face, op)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// Gameplay data lives in res/data, every file has a loader applying it to
+// the running game so it can be reloaded while playing. Waves refer to
+// enemies by name, so enemies have to be loaded first.
+var data_loaders = []struct {
+	name string
+	load func(g *Game, data []byte) error
+}{
+	{"enemies.json", LoadEnemyData},
+	{"weapons.json", LoadWeaponData},
+	{"waves.json", LoadWaveData},
+}
+
+var enemy_archetypes = map[string]*EnemyArchetype{
+	GruntArchetype.name:      GruntArchetype,
+	SwarmerArchetype.name:    SwarmerArchetype,
+	SkirmisherArchetype.name: SkirmisherArchetype,
+}
+
+type WeaponData struct {
+	Lifetime float64 `json:"lifetime"` // seconds
+	Velocity float64 `json:"velocity"`
+	Damage   int     `json:"damage"`
+}
+
+var weapons = map[string]WeaponData{
+	"blaster": {Lifetime: 1, Velocity: 3, Damage: 69},
+	"boss":    {Lifetime: 4, Velocity: 1.5, Damage: 10},
+}
+
+type WaveData struct {
+	Initial struct {
+		Count      int      `json:"count"`
+		Archetypes []string `json:"archetypes"`
+	} `json:"initial"`
+	Waves []struct {
+		At         float64  `json:"at"` // seconds
+		Count      int      `json:"count"`
+		Archetypes []string `json:"archetypes"`
+	} `json:"waves"`
+	BossAt float64 `json:"boss_at"`
+}
+
+type enemy_data struct {
+	MaxSpeed         float64 `json:"max_speed"`
+	MaxAccel         float64 `json:"max_accel"`
+	FleeRadius       float64 `json:"flee_radius"`
+	ArriveRadius     float64 `json:"arrive_radius"`
+	SeparationRadius float64 `json:"separation_radius"`
+	NeighbourRadius  float64 `json:"neighbour_radius"`
+	WanderRadius     float64 `json:"wander_radius"`
+	WanderDistance   float64 `json:"wander_distance"`
+	WanderJitter     float64 `json:"wander_jitter"`
+	AvoidDistance    float64 `json:"avoid_distance"`
+	AggroRadius      float64 `json:"aggro_radius"`
+	Memory           float64 `json:"memory"` // seconds
+	AttackRange      float64 `json:"attack_range"`
+	AttackWindup     float64 `json:"attack_windup"`   // seconds
+	AttackRecovery   float64 `json:"attack_recovery"` // seconds
+	Weights          struct {
+		Seek       float64 `json:"seek"`
+		Flee       float64 `json:"flee"`
+		Arrive     float64 `json:"arrive"`
+		Wander     float64 `json:"wander"`
+		Separation float64 `json:"separation"`
+		Alignment  float64 `json:"alignment"`
+		Cohesion   float64 `json:"cohesion"`
+		Avoidance  float64 `json:"avoidance"`
+	} `json:"weights"`
+}
+
+func SecondsToTicks(s float64) int {
+	return int(s * FPS)
+}
+
+// Loads every data file through the resource manager, a missing file keeps
+// the built in defaults.
+func LoadData(g *Game, resources *ResourceManager, dir string) error {
+	errs := LoadErrors{}
+	for _, loader := range data_loaders {
+		err := LoadDataFile(g, resources, dir, loader.name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err.(*LoadError))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Errors are always a *LoadError.
+func LoadDataFile(g *Game, resources *ResourceManager, dir string, name string) error {
+	file_path := path.Join(dir, name)
+	for _, loader := range data_loaders {
+		if loader.name != name {
+			continue
+		}
+		_, err := resources.Acquire(file_path)
+		defer resources.Release(file_path)
+		if err != nil {
+			return &LoadError{file_path, err}
+		}
+		data := GetResource[json.RawMessage](resources, file_path)
+		if err := loader.load(g, data); err != nil {
+			return &LoadError{file_path, err}
+		}
+		return nil
+	}
+	return &LoadError{file_path, fmt.Errorf("not a data file")}
+}
+
+// Archetypes are updated in place, so enemies already alive pick up the
+// new values.
+func LoadEnemyData(g *Game, data []byte) error {
+	entries := map[string]enemy_data{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	for name, d := range entries {
+		if d.MaxSpeed <= 0 || d.MaxAccel <= 0 {
+			return fmt.Errorf("enemy %q needs a positive max_speed and max_accel", name)
+		}
+		a, ok := enemy_archetypes[name]
+		if !ok {
+			a = &EnemyArchetype{}
+			enemy_archetypes[name] = a
+		}
+		*a = EnemyArchetype{
+			name:      name,
+			max_speed: d.MaxSpeed,
+			max_accel: d.MaxAccel,
+			weights: SteeringWeights{
+				seek:       d.Weights.Seek,
+				flee:       d.Weights.Flee,
+				arrive:     d.Weights.Arrive,
+				wander:     d.Weights.Wander,
+				separation: d.Weights.Separation,
+				alignment:  d.Weights.Alignment,
+				cohesion:   d.Weights.Cohesion,
+				avoidance:  d.Weights.Avoidance,
+			},
+			flee_radius:       d.FleeRadius,
+			arrive_radius:     d.ArriveRadius,
+			separation_radius: d.SeparationRadius,
+			neighbour_radius:  d.NeighbourRadius,
+			wander_radius:     d.WanderRadius,
+			wander_distance:   d.WanderDistance,
+			wander_jitter:     d.WanderJitter,
+			avoid_distance:    d.AvoidDistance,
+			aggro_radius:      d.AggroRadius,
+			memory:            SecondsToTicks(d.Memory),
+			attack_range:      d.AttackRange,
+			attack_windup:     SecondsToTicks(d.AttackWindup),
+			attack_recovery:   SecondsToTicks(d.AttackRecovery),
+		}
+	}
+	return nil
+}
+
+func LoadWeaponData(g *Game, data []byte) error {
+	entries := map[string]WeaponData{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for name, w := range entries {
+		if w.Lifetime <= 0 {
+			return fmt.Errorf("weapon %q needs a positive lifetime", name)
+		}
+		weapons[name] = w
+	}
+
+	if g.player != nil {
+		g.player.SetWeapon(weapons["blaster"])
+	}
+	if g.boss != nil {
+		g.boss.bullet_manager.SetWeapon(weapons["boss"])
+	}
+	return nil
+}
+
+// Replaces every planned wave that has not been spawned yet, a boss
+// waiting to retry its spawn keeps waiting.
+func LoadWaveData(g *Game, data []byte) error {
+	waves := WaveData{}
+	if err := json.Unmarshal(data, &waves); err != nil {
+		return err
+	}
+
+	events := []SpawnEvent{}
+	for i, w := range waves.Waves {
+		archetypes, err := lookupArchetypes(w.Archetypes)
+		if err != nil {
+			return fmt.Errorf("wave %d: %w", i, err)
+		}
+		events = append(events, SpawnEvent{at: SecondsToTicks(w.At), spawn: SpawnWave(w.Count, archetypes)})
+	}
+	if waves.BossAt > 0 {
+		events = append(events, SpawnEvent{at: SecondsToTicks(waves.BossAt), spawn: SpawnBoss()})
+	}
+	initial, err := lookupArchetypes(waves.Initial.Archetypes)
+	if err != nil && waves.Initial.Count > 0 {
+		return fmt.Errorf("initial: %w", err)
+	}
+
+	if waves.Initial.Count > 0 {
+		g.initial_count = waves.Initial.Count
+		g.initial_archetypes = initial
+	}
+	g.spawner.ClearPlanned()
+	for _, event := range events {
+		if event.at > g.spawner.tick {
+			g.spawner.Plan(event.at, event.spawn)
+		}
+	}
+	return nil
+}
+
+func lookupArchetypes(names []string) ([]*EnemyArchetype, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no archetypes listed")
+	}
+	archetypes := make([]*EnemyArchetype, len(names))
+	for i, name := range names {
+		a, ok := enemy_archetypes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown archetype %q", name)
+		}
+		archetypes[i] = a
+	}
+	return archetypes, nil
+}
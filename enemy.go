@@ -1,7 +1,11 @@
 package main
 
 import (
+	"math"
+	"math/rand"
+
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 )
 
 type EnemyState int
@@ -9,28 +13,35 @@ type EnemyState int
 const (
 	EnemyIdle EnemyState = iota
 	EnemyMoving
-	EnemyAttacking
-	EnemyAttackingMoving
+	EnemyWindup
+	EnemyRecovery
 	EnemyDying
 )
 
 const EnemyAnimationTimeout = 0.25 * FPS
 const EnemySize = 32
+const EnemyXP = 10
 
 type Enemy struct {
 	cc             CircleCollider
 	damage         int
 	health         int
-	speed          float64
+	vel            Vector2
+	archetype      *EnemyArchetype
+	wander_angle   float64
 	sprite         *ebiten.Image
 	target         Vector2
 	dir            dir
 	state          EnemyState
+	state_timer    int
+	last_seen      int
+	removed        bool
+	flash          int
 	animator       *Animator[EnemyState]
 	animation_task *Task
 }
 
-func NewEnemy(pos Vector2, tm *TextureManager) *Enemy {
+func NewEnemy(pos Vector2, archetype *EnemyArchetype, tm *TextureManager) *Enemy {
 
 	idle_sprites := []*ebiten.Image{
 		tm.GetTexture("ellen"),
@@ -42,14 +53,23 @@ func NewEnemy(pos Vector2, tm *TextureManager) *Enemy {
 		cc:     CircleCollider{pos: pos.Add(Vector2{EnemySize / 2, EnemySize / 2}), r: EnemySize / 2},
 		damage: 10,
 		health: 50,
-		speed:  0.33,
 		sprite: idle_sprites[0],
 		target: Vector2{0, 0},
 		state:  EnemyIdle,
+
+		archetype:    archetype,
+		wander_angle: rand.Float64() * 2 * math.Pi,
 	}
 	animator := NewAnimator[EnemyState](&e.sprite)
 	animator.AddAnimation(EnemyIdle, NewAnimation(idle_sprites, EnemyAnimationTimeout))
+	animator.AddAnimation(EnemyMoving, NewAnimation(idle_sprites, EnemyAnimationTimeout/2))
+	animator.AddAnimation(EnemyWindup, NewAnimation(idle_sprites, EnemyAnimationTimeout/3))
+	animator.AddAnimation(EnemyRecovery, NewAnimation(idle_sprites, EnemyAnimationTimeout))
+	animator.AddAnimation(EnemyDying, NewOneShotAnimation(idle_sprites, EnemyAnimationTimeout*2/3))
 	animator.SetAnimation(EnemyIdle)
+	animator.OnComplete(EnemyDying, func() {
+		e.removed = true
+	})
 
 	e.animator = animator
 
@@ -57,13 +77,19 @@ func NewEnemy(pos Vector2, tm *TextureManager) *Enemy {
 }
 
 func (e *Enemy) Update() {
-	e.target = game.player.rect.pos
+	e.target = game.player.rect.pos.Add(game.player.rect.extents.Scale(0.5))
+	e.state_timer++
 
-	diff := e.target.Sub(e.cc.pos)
-	// DONT REMOVE, ELSE ENEMIES VANISH INTO THE IEEE.754 SHADOW REALM
-	// Division by zero happens...
-	if diff.Mag() != 0 {
-		e.Move(diff)
+	if handler, ok := enemy_states[e.state]; ok && handler.update != nil {
+		handler.update(e)
+	}
+	e.animator.Update()
+	if e.flash > 0 {
+		e.flash--
+	}
+
+	if e.state == EnemyDying {
+		return
 	}
 
 	for _, other := range game.enemies_grid.GetNearbyEnemies(e.cc.pos) {
@@ -73,6 +99,59 @@ func (e *Enemy) Update() {
 	}
 }
 
+// Accelerates along the archetypes steering behaviours and moves. When not
+// chasing, the enemy flees from a close player instead of seeking him.
+func (e *Enemy) Steer(chase bool) {
+	neighbours := game.enemies_grid.GetNearbyEnemies(e.cc.pos)
+
+	accel := e.SteeringForce(neighbours, chase).Limit(e.archetype.max_accel)
+	e.vel = e.vel.Add(accel).Limit(e.archetype.max_speed)
+	// DONT REMOVE, ELSE ENEMIES VANISH INTO THE IEEE.754 SHADOW REALM
+	// Division by zero happens...
+	if e.vel.Mag() != 0 {
+		e.Move(e.vel)
+	}
+}
+
+// Sums up the weighted steering behaviours of the archetype.
+func (e *Enemy) SteeringForce(neighbours []*Enemy, chase bool) Vector2 {
+	a := e.archetype
+	w := a.weights
+	force := Vector2{0, 0}
+
+	if chase {
+		// follow the shared flow field, once in the players tile go straight for him
+		flow := game.flow_field.Direction(e.cc.pos)
+		if flow.IsZero() {
+			force.AddEq(Seek(e.cc.pos, e.vel, e.target, a.max_speed).Scale(w.seek))
+			force.AddEq(Arrive(e.cc.pos, e.vel, e.target, a.max_speed, a.arrive_radius).Scale(w.arrive))
+		} else {
+			force.AddEq(Seek(e.cc.pos, e.vel, e.cc.pos.Add(flow), a.max_speed).Scale(w.seek))
+		}
+	} else {
+		force.AddEq(Flee(e.cc.pos, e.vel, e.target, a.max_speed, a.flee_radius).Scale(w.flee))
+	}
+
+	force.AddEq(Wander(e.vel, &e.wander_angle, a.wander_radius, a.wander_distance, a.wander_jitter).Scale(a.max_speed * w.wander))
+
+	positions := []Vector2{}
+	vels := []Vector2{}
+	for _, other := range neighbours {
+		if other == e || other.state == EnemyDying || e.cc.pos.Dist(other.cc.pos) > a.neighbour_radius {
+			continue
+		}
+		positions = append(positions, other.cc.pos)
+		vels = append(vels, other.vel)
+	}
+
+	force.AddEq(Separation(e.cc.pos, positions, a.separation_radius).Scale(a.max_speed * w.separation))
+	force.AddEq(Alignment(e.vel, vels).Scale(w.alignment))
+	force.AddEq(Cohesion(e.cc.pos, e.vel, positions, a.max_speed).Scale(w.cohesion))
+	force.AddEq(ObstacleAvoidance(e.cc.pos, e.vel, game.world, a.avoid_distance).Scale(a.max_speed * w.avoidance))
+
+	return force
+}
+
 func (e *Enemy) Resolve(o *Enemy) {
 	diff := e.cc.pos.Sub(o.cc.pos)
 	distance := diff.Mag()
@@ -83,46 +162,82 @@ func (e *Enemy) Resolve(o *Enemy) {
 		overlap := totalRadius - distance
 		normal := diff.Norm()
 		separation := normal.Scale(overlap / 2)
-		e.cc.pos.AddEq(separation)
-		o.cc.pos.SubEq(separation)
+		// pushed apart without turning around, and never into a wall
+		e.push(separation)
+		o.push(separation.Scale(-1))
 	}
 }
 
-func (e *Enemy) Move(dir Vector2) {
-	if e.state == EnemyAttacking {
-		e.state = EnemyAttackingMoving
-	} else {
-		e.state = EnemyMoving
+func (e *Enemy) Move(mov Vector2) {
+	e.push(mov)
+
+	if mov.x < 0 {
+		e.dir = left
+	} else if mov.x > 0 {
+		e.dir = right
 	}
+}
 
-	e.cc.pos.AddEq(dir.Norm().Scale(e.speed))
+func (e *Enemy) push(mov Vector2) {
+	rect := e.Rect()
+	game.world.MoveRect(&rect, mov)
+	e.cc.pos = rect.pos.Add(Vector2{e.cc.r, e.cc.r})
+}
 
-	if e.cc.pos.x < 0 {
-		e.cc.pos.x = 0
+func (e *Enemy) TakeDamage(damage int) {
+	if e.state == EnemyDying {
+		return
 	}
-
-	if e.cc.pos.y < 0 {
-		e.cc.pos.y = 0
+	e.health -= damage
+	if e.health <= 0 {
+		e.SetState(EnemyDying)
+		return
 	}
-
-	if dir.x < 0 {
-		e.dir = left
-	} else if dir.x > 0 {
-		e.dir = right
+	// getting shot gives away where the player is
+	if e.state == EnemyIdle {
+		e.SetState(EnemyMoving)
 	}
 }
 
+func (e *Enemy) Alive() bool {
+	return e.state != EnemyDying
+}
+
+func (e *Enemy) Flash(ticks int) {
+	e.flash = ticks
+}
+
+func (e *Enemy) Removed() bool {
+	return e.removed
+}
+
+func (e *Enemy) Rect() Rect {
+	return NewRect(e.cc.pos.Sub(Vector2{e.cc.r, e.cc.r}), Vector2{2 * e.cc.r, 2 * e.cc.r})
+}
+
 func (e *Enemy) Draw(screen *ebiten.Image) {
 	op := &ebiten.DrawImageOptions{}
 	screen_pos := e.cc.pos.Sub(game.camera.rect.pos)
 
+	// dying enemies shrink and fade out, winding up ones glow red
+	size := EnemySize * (1 - e.DyingProgress()/2)
+	op.ColorScale.ScaleAlpha(float32(1 - e.DyingProgress()))
+	if e.state == EnemyWindup {
+		op.ColorScale.Scale(1, 0.5, 0.5, 1)
+	}
+
 	w := float64(e.sprite.Bounds().Dx())
 	h := float64(e.sprite.Bounds().Dy())
-	op.GeoM.Scale(EnemySize/w, EnemySize/h)
+	op.GeoM.Scale(size/w, size/h)
 	if e.dir == right {
 		op.GeoM.Scale(-1, 1)
-		screen_pos.x += EnemySize - 1
+		screen_pos.x += size - 1
 	}
-	op.GeoM.Translate(screen_pos.x-EnemySize/2, screen_pos.y-EnemySize/2)
-	screen.DrawImage(e.sprite, op)
+	op.GeoM.Translate(screen_pos.x-size/2, screen_pos.y-size/2)
+	DrawFlashing(screen, e.sprite, op, e.flash > 0)
+}
+
+func (e *Enemy) DebugDraw(screen *ebiten.Image) {
+	sp := e.cc.pos.Sub(game.camera.rect.pos)
+	ebitenutil.DebugPrintAt(screen, e.StateName(), int(sp.x)-EnemySize/2, int(sp.y)-EnemySize)
 }
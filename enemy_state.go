@@ -0,0 +1,145 @@
+package main
+
+// EnemyStateHandler is the behaviour of an enemy while it is in a state.
+// All callbacks are optional.
+type EnemyStateHandler struct {
+	name   string
+	enter  func(e *Enemy)
+	update func(e *Enemy)
+	exit   func(e *Enemy)
+}
+
+var enemy_states = map[EnemyState]*EnemyStateHandler{}
+
+// Registers or replaces the handler for a state, new states only need a
+// fresh EnemyState value.
+func RegisterEnemyState(state EnemyState, handler *EnemyStateHandler) {
+	enemy_states[state] = handler
+}
+
+func init() {
+	RegisterEnemyState(EnemyIdle, &EnemyStateHandler{
+		name:   "idle",
+		update: enemyIdleUpdate,
+	})
+	RegisterEnemyState(EnemyMoving, &EnemyStateHandler{
+		name:   "moving",
+		update: enemyChaseUpdate,
+	})
+	RegisterEnemyState(EnemyWindup, &EnemyStateHandler{
+		name:   "windup",
+		enter:  enemyWindupEnter,
+		update: enemyWindupUpdate,
+	})
+	RegisterEnemyState(EnemyRecovery, &EnemyStateHandler{
+		name:   "recovery",
+		enter:  enemyRecoveryEnter,
+		update: enemyRecoveryUpdate,
+	})
+	RegisterEnemyState(EnemyDying, &EnemyStateHandler{
+		name:  "dying",
+		enter: enemyDyingEnter,
+	})
+}
+
+func (e *Enemy) SetState(state EnemyState) {
+	if old, ok := enemy_states[e.state]; ok && old.exit != nil {
+		old.exit(e)
+	}
+
+	e.state = state
+	e.state_timer = 0
+	if _, ok := e.animator.animations[state]; ok {
+		e.animator.SetAnimation(state)
+	}
+
+	if handler, ok := enemy_states[state]; ok && handler.enter != nil {
+		handler.enter(e)
+	}
+}
+
+func (e *Enemy) StateName() string {
+	if handler, ok := enemy_states[e.state]; ok {
+		return handler.name
+	}
+	return "unknown"
+}
+
+// The player is noticed inside the aggro radius, but only when no wall is
+// in between.
+func (e *Enemy) CanSeePlayer() bool {
+	if e.cc.pos.Dist(e.target) > e.archetype.aggro_radius {
+		return false
+	}
+	return game.world.LineOfSight(e.cc.pos, e.target)
+}
+
+func enemyIdleUpdate(e *Enemy) {
+	e.Steer(false)
+	if e.CanSeePlayer() {
+		e.SetState(EnemyMoving)
+	}
+}
+
+func enemyChaseUpdate(e *Enemy) {
+	e.Steer(true)
+
+	if e.CanSeePlayer() {
+		e.last_seen = 0
+		if e.cc.pos.Dist(e.target) <= e.archetype.attack_range {
+			e.SetState(EnemyWindup)
+		}
+		return
+	}
+
+	// keep following the flow field for a while after losing sight
+	e.last_seen++
+	if e.last_seen > e.archetype.memory {
+		e.SetState(EnemyIdle)
+	}
+}
+
+func enemyWindupEnter(e *Enemy) {
+	e.vel = Vector2{0, 0}
+}
+
+func enemyWindupUpdate(e *Enemy) {
+	if e.state_timer < e.archetype.attack_windup {
+		return
+	}
+
+	// the strike only lands if the player did not get away during windup
+	if e.cc.pos.Dist(e.target) <= e.archetype.attack_range*1.25 {
+		game.player.TakeDamage(e.damage)
+	}
+	e.SetState(EnemyRecovery)
+}
+
+// the lunge stops dead
+func enemyRecoveryEnter(e *Enemy) {
+	e.vel = Vector2{0, 0}
+}
+
+func enemyRecoveryUpdate(e *Enemy) {
+	// stagger around, but dont close in during recovery
+	e.Steer(false)
+	if e.state_timer >= e.archetype.attack_recovery {
+		e.SetState(EnemyMoving)
+	}
+}
+
+func enemyDyingEnter(e *Enemy) {
+	e.vel = Vector2{0, 0}
+	game.audio_manager.PlayAt("enemy_death", e.cc.pos)
+	game.kills++
+	game.player.AddXP(EnemyXP)
+}
+
+// How far along the dying animation the enemy is, from 0 to 1. The enemy is
+// removed once the animation finished.
+func (e *Enemy) DyingProgress() float64 {
+	if e.state != EnemyDying {
+		return 0
+	}
+	return e.animator.Progress()
+}
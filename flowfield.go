@@ -0,0 +1,209 @@
+package main
+
+import (
+	"container/heap"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	flow_cost_straight = 10
+	flow_cost_diagonal = 14
+	flow_unreachable   = math.MaxInt32
+)
+
+var flow_neighbours = [8][2]int{
+	{1, 0}, {-1, 0}, {0, 1}, {0, -1},
+	{1, 1}, {1, -1}, {-1, 1}, {-1, -1},
+}
+
+const FlowFieldBudget = 2500
+
+// FlowField stores, for every walkable tile of the world, the direction
+// towards the goal along the cheapest path. It is shared by all enemies,
+// so the horde costs a single Dijkstra run per goal change. That run is
+// spread over several ticks, enemies follow the last finished field until
+// the next one is done.
+type FlowField struct {
+	world  *World
+	budget int
+	dist   []int
+	dirs   []Vector2
+	goal_x int
+	goal_y int
+	valid  bool
+	dirty  bool
+
+	// the field being computed, swapped in once it is done
+	next_dist []int
+	next_dirs []Vector2
+	next_x    int
+	next_y    int
+	open      flow_queue
+	searching bool
+}
+
+func NewFlowField(world *World, budget int) *FlowField {
+	n := world.width * world.height
+	return &FlowField{
+		world:     world,
+		budget:    budget,
+		dist:      make([]int, n),
+		dirs:      make([]Vector2, n),
+		next_dist: make([]int, n),
+		next_dirs: make([]Vector2, n),
+		valid:     false,
+		dirty:     true,
+	}
+}
+
+// Marks the field for recomputation, e.g. after the world changed.
+func (f *FlowField) Invalidate() {
+	f.dirty = true
+}
+
+// Starts a new computation when the goal moved into another tile or the
+// field was invalidated, and runs the current one for at most budget cells.
+// A computation is always finished before the next starts, so a fast goal
+// cannot keep the field from ever updating.
+func (f *FlowField) Update(goal Vector2) {
+	gx, gy := f.world.PosToCell(goal)
+	if !f.searching && (f.dirty || gx != f.goal_x || gy != f.goal_y) {
+		f.begin(gx, gy)
+	}
+	if f.searching {
+		f.search(f.budget)
+	}
+}
+
+func (f *FlowField) begin(gx int, gy int) {
+	w := f.world
+	f.dirty = false
+	if w.Solid(gx, gy) {
+		f.goal_x = gx
+		f.goal_y = gy
+		f.valid = false
+		return
+	}
+
+	for i := range f.next_dist {
+		f.next_dist[i] = flow_unreachable
+		f.next_dirs[i] = Vector2{0, 0}
+	}
+	start := gy*w.width + gx
+	f.next_dist[start] = 0
+	f.next_x = gx
+	f.next_y = gy
+	f.open = append(f.open[:0], flow_node{index: start, dist: 0})
+	f.searching = true
+}
+
+func (f *FlowField) search(budget int) {
+	w := f.world
+	for ; budget > 0 && f.open.Len() > 0; budget-- {
+		current := heap.Pop(&f.open).(flow_node)
+		if current.dist > f.next_dist[current.index] {
+			continue // stale entry
+		}
+
+		cx := current.index % w.width
+		cy := current.index / w.width
+		for _, n := range flow_neighbours {
+			nx, ny := cx+n[0], cy+n[1]
+			if w.Solid(nx, ny) {
+				continue
+			}
+
+			cost := flow_cost_straight
+			if n[0] != 0 && n[1] != 0 {
+				// dont cut corners, enemies would get stuck on them
+				if w.Solid(cx+n[0], cy) || w.Solid(cx, cy+n[1]) {
+					continue
+				}
+				cost = flow_cost_diagonal
+			}
+
+			index := ny*w.width + nx
+			dist := current.dist + cost
+			if dist < f.next_dist[index] {
+				f.next_dist[index] = dist
+				// neighbour flows back towards the cell it was reached from
+				f.next_dirs[index] = Vector2{float64(-n[0]), float64(-n[1])}.Norm()
+				heap.Push(&f.open, flow_node{index: index, dist: dist})
+			}
+		}
+	}
+	if f.open.Len() > 0 {
+		return
+	}
+
+	f.dist, f.next_dist = f.next_dist, f.dist
+	f.dirs, f.next_dirs = f.next_dirs, f.dirs
+	f.goal_x = f.next_x
+	f.goal_y = f.next_y
+	f.valid = true
+	f.searching = false
+}
+
+// Returns the direction to follow from pos. The zero vector means the goal
+// tile was reached or that there is no path from pos.
+func (f *FlowField) Direction(pos Vector2) Vector2 {
+	if !f.valid {
+		return Vector2{0, 0}
+	}
+	x, y := f.world.PosToCell(pos)
+	if !f.world.InBounds(x, y) {
+		return Vector2{0, 0}
+	}
+	return f.dirs[y*f.world.width+x]
+}
+
+// Returns the path cost from pos to the goal, or false when unreachable.
+func (f *FlowField) Distance(pos Vector2) (int, bool) {
+	x, y := f.world.PosToCell(pos)
+	if !f.valid || !f.world.InBounds(x, y) {
+		return 0, false
+	}
+	d := f.dist[y*f.world.width+x]
+	return d, d != flow_unreachable
+}
+
+func (f *FlowField) DebugDraw(screen *ebiten.Image) {
+	x0, y0 := f.world.PosToCell(game.camera.rect.pos)
+	x1, y1 := f.world.PosToCell(game.camera.rect.pos.Add(game.camera.rect.extents))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if !f.world.InBounds(x, y) {
+				continue
+			}
+			d := f.dirs[y*f.world.width+x]
+			if d.x == 0 && d.y == 0 {
+				continue
+			}
+			c := f.world.CellCenter(x, y).Sub(game.camera.rect.pos)
+			e := c.Add(d.Scale(TileSize / 3))
+			vector.StrokeLine(screen, float32(c.x), float32(c.y), float32(e.x), float32(e.y), 1, color.RGBA{0, 255, 120, 120}, false)
+		}
+	}
+}
+
+type flow_node struct {
+	index int
+	dist  int
+}
+
+type flow_queue []flow_node
+
+func (q flow_queue) Len() int            { return len(q) }
+func (q flow_queue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q flow_queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *flow_queue) Push(x interface{}) { *q = append(*q, x.(flow_node)) }
+func (q *flow_queue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
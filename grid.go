@@ -69,6 +69,22 @@ func (s *SpatialGrid) GetNearbyEnemies(pos Vector2) []*Enemy {
 	return nearbyEnemies
 }
 
+// Every enemy in the cells r overlaps, some may be just outside of it.
+func (s *SpatialGrid) GetEnemiesInRect(r Rect) []*Enemy {
+	var enemies []*Enemy
+	x0 := int(math.Max(0, math.Floor(r.pos.x/s.cellSize)))
+	y0 := int(math.Max(0, math.Floor(r.pos.y/s.cellSize)))
+	x1 := int(math.Min(float64(s.width-1), math.Floor((r.pos.x+r.extents.x)/s.cellSize)))
+	y1 := int(math.Min(float64(s.height-1), math.Floor((r.pos.y+r.extents.y)/s.cellSize)))
+
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			enemies = append(enemies, s.cells[y*s.width+x]...)
+		}
+	}
+	return enemies
+}
+
 func DebugDrawEnemies(screen *ebiten.Image, enemies []*Enemy) {
 	for _, enemy := range enemies {
 		screen_pos := enemy.cc.pos.Sub(game.camera.rect.pos)
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const ReloadInterval = FPS / 2
+
+// DevReloader polls the resource file system for changed files and reloads
+// them into the running game. Load errors are kept per file and drawn on
+// screen until the file loads again. Only files on disk have modification
+// times, so only the mods directory is watched in practice.
+type DevReloader struct {
+	fsys     fs.FS
+	data_dir string
+	mtimes   map[string]time.Time
+	errors   map[string]error
+	task     *Task
+}
+
+func NewDevReloader(g *Game, fsys fs.FS, data_dir string) *DevReloader {
+	d := &DevReloader{
+		fsys:     fsys,
+		data_dir: path.Clean(data_dir),
+		mtimes:   make(map[string]time.Time),
+		errors:   make(map[string]error),
+	}
+	// whatever exists now was just loaded by the game itself
+	d.Changed()
+	d.task = NewTask(ReloadInterval, func() {
+		for _, file_path := range d.Changed() {
+			d.Reload(g, file_path)
+		}
+	})
+	return d
+}
+
+func (d *DevReloader) Update() {
+	d.task.Update()
+}
+
+// Returns every file modified since the last call, in a stable order so
+// sheet images reload before their manifests.
+func (d *DevReloader) Changed() []string {
+	changed := []string{}
+	fs.WalkDir(d.fsys, ".", func(file_path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if last, ok := d.mtimes[file_path]; !ok || info.ModTime().After(last) {
+			d.mtimes[file_path] = info.ModTime()
+			changed = append(changed, file_path)
+		}
+		return nil
+	})
+	sort.Slice(changed, func(i, j int) bool {
+		pi := strings.HasSuffix(changed[i], ".png")
+		pj := strings.HasSuffix(changed[j], ".png")
+		if pi != pj {
+			return pi
+		}
+		return changed[i] < changed[j]
+	})
+	return changed
+}
+
+func (d *DevReloader) Reload(g *Game, file_path string) {
+	var err error
+	switch {
+	case path.Dir(file_path) == d.data_dir:
+		// preloaded data files would otherwise be applied from the cache
+		if g.resources.Loaded(file_path) {
+			if err = g.resources.Reload(file_path); err != nil {
+				err = &LoadError{file_path, err}
+				break
+			}
+		}
+		err = LoadDataFile(g, g.resources, d.data_dir, path.Base(file_path))
+	case strings.HasSuffix(file_path, ".png"):
+		err = g.texture_manager.ReloadTexture(file_path)
+	case g.resources.Loaded(file_path) && !strings.HasSuffix(file_path, ".json"):
+		if err = g.resources.Reload(file_path); err != nil {
+			err = &LoadError{file_path, err}
+		}
+	default:
+		err = g.texture_manager.LoadFile(file_path)
+	}
+	d.Report(file_path, err)
+}
+
+// Remembers the error of a file, or forgets it when err is nil. Aggregated
+// load errors are split up by file.
+func (d *DevReloader) Report(file_path string, err error) {
+	var errs LoadErrors
+	if errors.As(err, &errs) {
+		for _, err := range errs {
+			d.Report(err.path, err)
+		}
+		return
+	}
+	var load_err *LoadError
+	if errors.As(err, &load_err) {
+		file_path = load_err.path
+	}
+
+	key := path.Clean(file_path)
+	if err != nil {
+		d.errors[key] = err
+	} else {
+		delete(d.errors, key)
+	}
+}
+
+// Drawn in screen space, along the bottom edge.
+func (d *DevReloader) Draw(screen *ebiten.Image) {
+	if len(d.errors) == 0 {
+		return
+	}
+	lines := []string{}
+	for _, err := range d.errors {
+		lines = append(lines, err.Error())
+	}
+	sort.Strings(lines)
+
+	h := 16 * (len(lines) + 1)
+	y := screen.Bounds().Dy() - h
+	vector.DrawFilledRect(screen, 0, float32(y), float32(screen.Bounds().Dx()), float32(h), color.RGBA{120, 0, 0, 200}, false)
+	ebitenutil.DebugPrintAt(screen, "resource errors:\n"+strings.Join(lines, "\n"), 4, y)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Without the font file the HUD falls back to a bitmap font.
+const HUDFont = "fonts/hud.ttf"
+const HUDFontSize = 12
+
+const hud_margin = 8
+const hud_bar_width = 160
+const hud_bar_height = 8
+
+// HUD is drawn in screen space on top of the world.
+type HUD struct {
+	face text.Face
+}
+
+func NewHUD(resources *ResourceManager) *HUD {
+	return &HUD{face: resources.Face(HUDFont, HUDFontSize)}
+}
+
+func (h *HUD) Draw(screen *ebiten.Image, g *Game) {
+	sw := float64(screen.Bounds().Dx())
+	sh := float64(screen.Bounds().Dy())
+	p := g.player
+	line := h.LineHeight()
+
+	// health and experience in the bottom left corner
+	x := float64(hud_margin)
+	y := sh - hud_margin - 2*(line+hud_bar_height+4)
+	h.Text(screen, fmt.Sprintf("HP %d/%d", p.health, p.max_health), x, y, text.AlignStart, color.White)
+	y += line + 2
+	h.Bar(screen, x, y, float64(p.health)/float64(p.max_health), color.RGBA{200, 30, 60, 255})
+	y += hud_bar_height + 4
+	h.Text(screen, fmt.Sprintf("LV %d  %d/%d XP", p.lvl+1, p.xp, XPToNext(p.lvl)), x, y, text.AlignStart, color.White)
+	y += line + 2
+	h.Bar(screen, x, y, float64(p.xp)/float64(XPToNext(p.lvl)), color.RGBA{60, 160, 255, 255})
+
+	// run stats in the top right corner
+	x = sw - hud_margin
+	y = hud_margin
+	seconds := g.ticks / FPS
+	h.Text(screen, fmt.Sprintf("%02d:%02d", seconds/60, seconds%60), x, y, text.AlignEnd, color.White)
+	y += line
+	h.Text(screen, fmt.Sprintf("kills %d", g.kills), x, y, text.AlignEnd, color.RGBA{200, 200, 200, 255})
+	y += line
+	h.Text(screen, fmt.Sprintf("wave %d", g.spawner.wave), x, y, text.AlignEnd, color.RGBA{200, 200, 200, 255})
+}
+
+func (h *HUD) LineHeight() float64 {
+	return h.face.Metrics().HAscent + h.face.Metrics().HDescent + 2
+}
+
+func (h *HUD) Text(screen *ebiten.Image, str string, x float64, y float64, align text.Align, clr color.Color) {
+	DrawText(screen, str, h.face, x, y, align, clr)
+}
+
+func DrawText(screen *ebiten.Image, str string, face text.Face, x float64, y float64, align text.Align, clr color.Color) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(x, y)
+	op.PrimaryAlign = align
+	op.ColorScale.ScaleWithColor(clr)
+	text.Draw(screen, str, face, op)
+}
+
+// fill goes from 0 to 1.
+func (h *HUD) Bar(screen *ebiten.Image, x float64, y float64, fill float64, clr color.Color) {
+	if fill < 0 {
+		fill = 0
+	}
+	if fill > 1 {
+		fill = 1
+	}
+	vector.DrawFilledRect(screen, float32(x)-1, float32(y)-1, hud_bar_width+2, hud_bar_height+2, color.RGBA{0, 0, 0, 200}, false)
+	vector.DrawFilledRect(screen, float32(x), float32(y), float32(fill*hud_bar_width), hud_bar_height, clr, false)
+}
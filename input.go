@@ -0,0 +1,423 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const BindingsFileName = "bindings.json"
+const DefaultDeadzone = 0.2
+
+// Action is something the player can do, bound to any number of keys,
+// buttons and stick directions.
+type Action int
+
+const (
+	ActionMoveUp Action = iota
+	ActionMoveDown
+	ActionMoveLeft
+	ActionMoveRight
+	ActionFire
+	ActionPause
+	ActionToggleDebug
+	ActionSpawnBoss
+	ActionDebugPath
+	ActionQuit
+	action_count
+)
+
+// names in the bindings file, in the order of the actions
+var action_names = [action_count]string{
+	"move_up",
+	"move_down",
+	"move_left",
+	"move_right",
+	"fire",
+	"pause",
+	"toggle_debug",
+	"spawn_boss",
+	"debug_path",
+	"quit",
+}
+
+// labels on the controls screen
+var action_labels = [action_count]string{
+	"Move up",
+	"Move down",
+	"Move left",
+	"Move right",
+	"Fire",
+	"Pause",
+	"Toggle debug",
+	"Spawn boss",
+	"Debug path",
+	"Quit",
+}
+
+func (a Action) String() string {
+	return action_names[a]
+}
+
+func (a Action) Label() string {
+	return action_labels[a]
+}
+
+type BindingKind int
+
+const (
+	BindKey BindingKind = iota
+	BindMouse
+	BindPadButton
+	BindPadAxis
+)
+
+// Binding is one input that triggers an action. Axes only count in the
+// direction of sign and past the deadzone.
+type Binding struct {
+	kind BindingKind
+	code int // the key, mouse button, standard gamepad button or axis
+	sign float64
+}
+
+func Key(key ebiten.Key) Binding {
+	return Binding{kind: BindKey, code: int(key)}
+}
+
+func Mouse(button ebiten.MouseButton) Binding {
+	return Binding{kind: BindMouse, code: int(button)}
+}
+
+func PadButton(button ebiten.StandardGamepadButton) Binding {
+	return Binding{kind: BindPadButton, code: int(button)}
+}
+
+func PadAxis(axis ebiten.StandardGamepadAxis, sign float64) Binding {
+	return Binding{kind: BindPadAxis, code: int(axis), sign: sign}
+}
+
+var mouse_names = map[ebiten.MouseButton]string{
+	ebiten.MouseButtonLeft:   "Left",
+	ebiten.MouseButtonMiddle: "Middle",
+	ebiten.MouseButtonRight:  "Right",
+}
+
+var pad_button_names = map[ebiten.StandardGamepadButton]string{
+	ebiten.StandardGamepadButtonRightBottom:      "A",
+	ebiten.StandardGamepadButtonRightRight:       "B",
+	ebiten.StandardGamepadButtonRightLeft:        "X",
+	ebiten.StandardGamepadButtonRightTop:         "Y",
+	ebiten.StandardGamepadButtonFrontTopLeft:     "LB",
+	ebiten.StandardGamepadButtonFrontTopRight:    "RB",
+	ebiten.StandardGamepadButtonFrontBottomLeft:  "LT",
+	ebiten.StandardGamepadButtonFrontBottomRight: "RT",
+	ebiten.StandardGamepadButtonCenterLeft:       "Back",
+	ebiten.StandardGamepadButtonCenterRight:      "Start",
+	ebiten.StandardGamepadButtonLeftStick:        "LeftStick",
+	ebiten.StandardGamepadButtonRightStick:       "RightStick",
+	ebiten.StandardGamepadButtonLeftTop:          "DPadUp",
+	ebiten.StandardGamepadButtonLeftBottom:       "DPadDown",
+	ebiten.StandardGamepadButtonLeftLeft:         "DPadLeft",
+	ebiten.StandardGamepadButtonLeftRight:        "DPadRight",
+	ebiten.StandardGamepadButtonCenterCenter:     "Home",
+}
+
+var pad_axis_names = map[ebiten.StandardGamepadAxis]string{
+	ebiten.StandardGamepadAxisLeftStickHorizontal:  "LeftX",
+	ebiten.StandardGamepadAxisLeftStickVertical:    "LeftY",
+	ebiten.StandardGamepadAxisRightStickHorizontal: "RightX",
+	ebiten.StandardGamepadAxisRightStickVertical:   "RightY",
+}
+
+// Formats as kind:name, like key:Space, mouse:Right, pad:A or axis:LeftY-.
+func (b Binding) String() string {
+	switch b.kind {
+	case BindKey:
+		return "key:" + ebiten.Key(b.code).String()
+	case BindMouse:
+		return "mouse:" + mouse_names[ebiten.MouseButton(b.code)]
+	case BindPadButton:
+		return "pad:" + pad_button_names[ebiten.StandardGamepadButton(b.code)]
+	case BindPadAxis:
+		sign := "+"
+		if b.sign < 0 {
+			sign = "-"
+		}
+		return "axis:" + pad_axis_names[ebiten.StandardGamepadAxis(b.code)] + sign
+	}
+	return "unknown"
+}
+
+// Short name for the controls screen.
+func (b Binding) Label() string {
+	kind, name, _ := strings.Cut(b.String(), ":")
+	switch kind {
+	case "mouse":
+		return "Mouse " + name
+	case "pad", "axis":
+		return "Pad " + name
+	}
+	return name
+}
+
+func ParseBinding(str string) (Binding, error) {
+	kind, name, ok := strings.Cut(str, ":")
+	if !ok {
+		return Binding{}, fmt.Errorf("binding %q is not kind:name", str)
+	}
+	switch kind {
+	case "key":
+		var key ebiten.Key
+		if err := key.UnmarshalText([]byte(name)); err != nil {
+			return Binding{}, err
+		}
+		return Key(key), nil
+	case "mouse":
+		for button, n := range mouse_names {
+			if n == name {
+				return Mouse(button), nil
+			}
+		}
+	case "pad":
+		for button, n := range pad_button_names {
+			if n == name {
+				return PadButton(button), nil
+			}
+		}
+	case "axis":
+		sign := 1.0
+		if strings.HasSuffix(name, "-") {
+			sign = -1
+		}
+		name = strings.TrimRight(name, "+-")
+		for axis, n := range pad_axis_names {
+			if n == name {
+				return PadAxis(axis, sign), nil
+			}
+		}
+	}
+	return Binding{}, fmt.Errorf("unknown binding %q", str)
+}
+
+// InputMap maps the actions to their bindings and keeps their state for
+// the current and the previous tick.
+type InputMap struct {
+	bindings [action_count][]Binding
+	deadzone float64
+	values   [action_count]float64
+	prev     [action_count]float64
+	gamepads []ebiten.GamepadID
+	path     string // where Save writes to, empty to not persist
+}
+
+func DefaultInputMap() *InputMap {
+	m := &InputMap{deadzone: DefaultDeadzone}
+	m.Reset()
+	return m
+}
+
+// Goes back to the default bindings.
+func (m *InputMap) Reset() {
+	m.bindings = [action_count][]Binding{
+		ActionMoveUp: {
+			Key(ebiten.KeyW), Key(ebiten.KeyArrowUp),
+			PadButton(ebiten.StandardGamepadButtonLeftTop), PadAxis(ebiten.StandardGamepadAxisLeftStickVertical, -1),
+		},
+		ActionMoveDown: {
+			Key(ebiten.KeyS), Key(ebiten.KeyArrowDown),
+			PadButton(ebiten.StandardGamepadButtonLeftBottom), PadAxis(ebiten.StandardGamepadAxisLeftStickVertical, 1),
+		},
+		ActionMoveLeft: {
+			Key(ebiten.KeyA), Key(ebiten.KeyArrowLeft),
+			PadButton(ebiten.StandardGamepadButtonLeftLeft), PadAxis(ebiten.StandardGamepadAxisLeftStickHorizontal, -1),
+		},
+		ActionMoveRight: {
+			Key(ebiten.KeyD), Key(ebiten.KeyArrowRight),
+			PadButton(ebiten.StandardGamepadButtonLeftRight), PadAxis(ebiten.StandardGamepadAxisLeftStickHorizontal, 1),
+		},
+		ActionFire: {
+			Key(ebiten.KeySpace),
+			PadButton(ebiten.StandardGamepadButtonRightBottom), PadButton(ebiten.StandardGamepadButtonFrontBottomRight),
+		},
+		ActionPause:       {Key(ebiten.KeyEscape), Key(ebiten.KeyP), PadButton(ebiten.StandardGamepadButtonCenterRight)},
+		ActionToggleDebug: {Key(ebiten.KeyR), PadButton(ebiten.StandardGamepadButtonCenterLeft)},
+		ActionSpawnBoss:   {Key(ebiten.KeyB)},
+		ActionDebugPath:   {Mouse(ebiten.MouseButtonRight)},
+		ActionQuit:        {Key(ebiten.KeyQ)},
+	}
+}
+
+// The default bindings overridden by the ones in the file at path.
+func LoadInputMap(file_path string) (*InputMap, error) {
+	m := DefaultInputMap()
+	m.path = file_path
+	file := struct {
+		Deadzone *float64            `json:"deadzone"`
+		Bindings map[string][]string `json:"bindings"`
+	}{}
+	if err := loadJSONConfig(file_path, &file); err != nil {
+		return m, err
+	}
+	if file.Deadzone != nil {
+		m.deadzone = math.Max(0, math.Min(0.9, *file.Deadzone))
+	}
+	for name, strs := range file.Bindings {
+		action, ok := ActionByName(name)
+		if !ok {
+			return m, &LoadError{file_path, fmt.Errorf("unknown action %q", name)}
+		}
+		bindings := []Binding{}
+		for _, str := range strs {
+			binding, err := ParseBinding(str)
+			if err != nil {
+				return m, &LoadError{file_path, err}
+			}
+			bindings = append(bindings, binding)
+		}
+		m.bindings[action] = bindings
+	}
+	return m, nil
+}
+
+func ActionByName(name string) (Action, bool) {
+	for a, n := range action_names {
+		if n == name {
+			return Action(a), true
+		}
+	}
+	return 0, false
+}
+
+func (m *InputMap) Save() error {
+	file := struct {
+		Deadzone float64             `json:"deadzone"`
+		Bindings map[string][]string `json:"bindings"`
+	}{m.deadzone, map[string][]string{}}
+	for a, bindings := range m.bindings {
+		strs := []string{}
+		for _, binding := range bindings {
+			strs = append(strs, binding.String())
+		}
+		file.Bindings[action_names[a]] = strs
+	}
+	return saveJSONConfig(m.path, file)
+}
+
+func (m *InputMap) Bindings(a Action) []Binding {
+	return m.bindings[a]
+}
+
+// Adds binding to the action, unless it already has it.
+func (m *InputMap) Bind(a Action, binding Binding) {
+	for _, b := range m.bindings[a] {
+		if b == binding {
+			return
+		}
+	}
+	m.bindings[a] = append(m.bindings[a], binding)
+}
+
+func (m *InputMap) Unbind(a Action) {
+	m.bindings[a] = nil
+}
+
+// Polls every action, once per tick.
+func (m *InputMap) Update() {
+	m.gamepads = ebiten.AppendGamepadIDs(m.gamepads[:0])
+	m.prev = m.values
+	for a := range m.bindings {
+		m.values[a] = 0
+		for _, binding := range m.bindings[a] {
+			m.values[a] = math.Max(m.values[a], m.poll(binding))
+		}
+	}
+}
+
+// How far the binding is held, from 0 to 1. Sticks are rescaled to start
+// from 0 at the edge of the deadzone.
+func (m *InputMap) poll(b Binding) float64 {
+	held := func(pressed bool) float64 {
+		if pressed {
+			return 1
+		}
+		return 0
+	}
+	switch b.kind {
+	case BindKey:
+		return held(ebiten.IsKeyPressed(ebiten.Key(b.code)))
+	case BindMouse:
+		return held(ebiten.IsMouseButtonPressed(ebiten.MouseButton(b.code)))
+	}
+
+	value := 0.0
+	for _, id := range m.gamepads {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		if b.kind == BindPadButton {
+			value = math.Max(value, held(ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButton(b.code))))
+			continue
+		}
+		v := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxis(b.code)) * b.sign
+		if v > m.deadzone {
+			value = math.Max(value, math.Min(1, (v-m.deadzone)/(1-m.deadzone)))
+		}
+	}
+	return value
+}
+
+func (m *InputMap) Value(a Action) float64 {
+	return m.values[a]
+}
+
+func (m *InputMap) Pressed(a Action) bool {
+	return m.values[a] > 0
+}
+
+func (m *InputMap) JustPressed(a Action) bool {
+	return m.values[a] > 0 && m.prev[a] == 0
+}
+
+// The movement actions as a direction of at most length 1, shorter when a
+// stick is only tilted part of the way.
+func (m *InputMap) Movement() Vector2 {
+	dir := Vector2{
+		m.Value(ActionMoveRight) - m.Value(ActionMoveLeft),
+		m.Value(ActionMoveDown) - m.Value(ActionMoveUp),
+	}
+	if dir.Mag() > 1 {
+		return dir.Norm()
+	}
+	return dir
+}
+
+// The first key, mouse button, gamepad button or stick direction pressed
+// this tick, for rebinding.
+func (m *InputMap) Capture() (Binding, bool) {
+	if keys := inpututil.AppendJustPressedKeys(nil); len(keys) > 0 {
+		return Key(keys[0]), true
+	}
+	for button := range mouse_names {
+		if inpututil.IsMouseButtonJustPressed(button) {
+			return Mouse(button), true
+		}
+	}
+	for _, id := range m.gamepads {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		if buttons := inpututil.AppendJustPressedStandardGamepadButtons(id, nil); len(buttons) > 0 {
+			return PadButton(buttons[0]), true
+		}
+		for axis := range pad_axis_names {
+			v := ebiten.StandardGamepadAxisValue(id, axis)
+			if math.Abs(v) > 0.5 {
+				return PadAxis(axis, math.Copysign(1, v)), true
+			}
+		}
+	}
+	return Binding{}, false
+}
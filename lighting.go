@@ -0,0 +1,142 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const LightShader = "shaders/light.kage"
+
+// how much of the ambient light is taken away, 1 is pitch black
+const AmbientDarkness = 0.7
+
+const PlayerLightRadius = 180
+const BulletLightRadius = 40
+const MuzzleLightRadius = 64
+const MuzzleLightTicks = FPS / 20
+const ExplosionLightRadius = 120
+const ExplosionLightTicks = FPS / 4
+
+var PlayerLightColor = color.RGBA{255, 220, 170, 255}
+var BulletLightColor = color.RGBA{255, 80, 180, 255}
+var BossBulletLightColor = color.RGBA{255, 60, 40, 255}
+var ExplosionLightColor = color.RGBA{255, 160, 60, 255}
+
+// the ambient light is slightly blue, like moonlight
+var ambient_tint = [3]float64{0.8, 0.85, 1}
+
+// Light is a point light in world space.
+type Light struct {
+	pos    Vector2
+	radius float64
+	color  color.RGBA
+}
+
+// flashes are lights that fade out over a few ticks, for explosions
+type flash struct {
+	light Light
+	ticks int
+	total int
+}
+
+// blends the light map over the world by multiplying
+var blend_multiply = ebiten.Blend{
+	BlendFactorSourceRGB:        ebiten.BlendFactorZero,
+	BlendFactorSourceAlpha:      ebiten.BlendFactorZero,
+	BlendFactorDestinationRGB:   ebiten.BlendFactorSourceColor,
+	BlendFactorDestinationAlpha: ebiten.BlendFactorOne,
+	BlendOperationRGB:           ebiten.BlendOperationAdd,
+	BlendOperationAlpha:         ebiten.BlendOperationAdd,
+}
+
+// Lighting darkens the world down to the ambient light and adds the point
+// lights of the frame on top. The lights are accumulated into a light map by
+// a Kage shader, which is then multiplied over the world.
+type Lighting struct {
+	resources *ResourceManager
+	darkness  float64
+	lights    []Light
+	flashes   []*flash
+	lightmap  *ebiten.Image
+}
+
+func NewLighting(resources *ResourceManager) *Lighting {
+	return &Lighting{resources: resources, darkness: AmbientDarkness}
+}
+
+func (l *Lighting) SetDarkness(darkness float64) {
+	l.darkness = math.Max(0, math.Min(1, darkness))
+}
+
+// Adds a light for the next Draw only.
+func (l *Lighting) Add(pos Vector2, radius float64, clr color.RGBA) {
+	l.lights = append(l.lights, Light{pos: pos, radius: radius, color: clr})
+}
+
+// Adds a light that fades out over ticks.
+func (l *Lighting) Flash(pos Vector2, radius float64, clr color.RGBA, ticks int) {
+	l.flashes = append(l.flashes, &flash{light: Light{pos: pos, radius: radius, color: clr}, ticks: ticks, total: ticks})
+}
+
+func (l *Lighting) Update() {
+	alive := l.flashes[:0]
+	for _, f := range l.flashes {
+		f.ticks--
+		if f.ticks > 0 {
+			alive = append(alive, f)
+		}
+	}
+	l.flashes = alive
+}
+
+// Lights the world drawn on screen so far, as seen through the camera, and
+// drops the lights of this frame. Without the shader the world stays lit.
+func (l *Lighting) Draw(screen *ebiten.Image, camera Rect) {
+	lights := l.lights
+	l.lights = l.lights[:0]
+	shader := GetResource[*ebiten.Shader](l.resources, LightShader)
+	if shader == nil || !settings.Lighting {
+		return
+	}
+
+	size := screen.Bounds().Size()
+	if l.lightmap == nil || l.lightmap.Bounds().Size() != size {
+		l.lightmap = ebiten.NewImage(size.X, size.Y)
+	}
+	ambient := 1 - l.darkness
+	l.lightmap.Fill(color.RGBA{
+		uint8(255 * ambient * ambient_tint[0]),
+		uint8(255 * ambient * ambient_tint[1]),
+		uint8(255 * ambient * ambient_tint[2]),
+		255,
+	})
+
+	for _, f := range l.flashes {
+		light := f.light
+		light.radius *= float64(f.ticks) / float64(f.total)
+		lights = append(lights, light)
+	}
+	for _, light := range lights {
+		bounds := NewRect(light.pos.Sub(Vector2{light.radius, light.radius}), Vector2{2 * light.radius, 2 * light.radius})
+		if light.radius <= 0 || !camera.Intersects(bounds) {
+			continue
+		}
+		sp := bounds.pos.Sub(camera.pos)
+		center := light.pos.Sub(camera.pos)
+		op := &ebiten.DrawRectShaderOptions{}
+		op.GeoM.Translate(sp.x, sp.y)
+		op.Blend = ebiten.BlendLighter
+		op.Uniforms = map[string]any{
+			"Center": []float32{float32(center.x), float32(center.y)},
+			"Radius": float32(light.radius),
+			"Color":  []float32{float32(light.color.R) / 255, float32(light.color.G) / 255, float32(light.color.B) / 255},
+		}
+		l.lightmap.DrawRectShader(int(bounds.extents.x), int(bounds.extents.y), shader, op)
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.Blend = blend_multiply
+	screen.DrawImage(l.lightmap, op)
+}
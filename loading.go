@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const loading_bar_width = 200
+const loading_bar_height = 6
+
+// LoadingScene shows the progress of the preloaded resources and moves on
+// to the title once they are all in.
+type LoadingScene struct {
+	resources *ResourceManager
+}
+
+func NewLoadingScene(resources *ResourceManager) *LoadingScene {
+	return &LoadingScene{resources: resources}
+}
+
+func (l *LoadingScene) Update(scenes *SceneManager) error {
+	if !l.resources.Loading() {
+		// the font and theme textures are only in now
+		scenes.face = l.resources.Face(HUDFont, HUDFontSize)
+		tm, err := NewTextureManager(l.resources, "unknown.png")
+		if err != nil {
+			return err
+		}
+		if err := LoadUITextures(tm); err != nil {
+			return err
+		}
+		scenes.theme = NewUITheme(tm, scenes.face)
+		scenes.Reset(func() Scene { return NewTitleScene(scenes) })
+	}
+	return nil
+}
+
+func (l *LoadingScene) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{50, 50, 55, 255})
+	sw := float32(screen.Bounds().Dx())
+	sh := float32(screen.Bounds().Dy())
+	x := sw/2 - loading_bar_width/2
+	y := sh / 2
+	fill := float32(l.resources.Progress()) * loading_bar_width
+
+	vector.DrawFilledRect(screen, x-1, y-1, loading_bar_width+2, loading_bar_height+2, color.RGBA{0, 0, 0, 200}, false)
+	vector.DrawFilledRect(screen, x, y, fill, loading_bar_height, color.RGBA{255, 30, 150, 255}, false)
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("loading %d%%", int(l.resources.Progress()*100)), int(x), int(y)-16)
+}
+
+func (l *LoadingScene) Opaque() bool {
+	return true
+}
@@ -1,95 +1,251 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image/color"
+	"log"
 	"math/rand"
+	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 const FPS = 120
 
+var dev_mode = flag.Bool("dev", false, "reload changed resources while running and show load errors instead of exiting")
+var mods_dir = flag.String("mods", "", "directory overriding the built in resources, defaults to ./res in dev mode and mods next to the executable otherwise")
+var strict_mode = flag.Bool("strict", false, "exit listing every missing resource instead of drawing placeholders")
+var validate_mode = flag.Bool("validate", false, "check every resource and referenced key, then exit")
+var hit_stop = flag.Bool("hitstop", true, "freeze the game for a few frames on critical hits")
+var lighting = flag.Bool("lighting", true, "darken the world and light it with point lights")
+var debug_mode = flag.Bool("debug", false, "start runs with the debug view on")
+var window_width = flag.Int("width", 1920, "window width")
+var window_height = flag.Int("height", 1200, "window height")
+var fullscreen = flag.Bool("fullscreen", false, "start in fullscreen")
+var vsync = flag.Bool("vsync", true, "wait for the display to draw frames")
+var pixel_scale = flag.Int("scale", 0, "largest whole factor to scale the game up by, up to 4, 0 picks the largest that fits")
+var master_volume = flag.Float64("volume", 1, "master volume from 0 to 1")
+var music_volume = flag.Float64("music", 0.5, "music volume from 0 to 1")
+var sfx_volume = flag.Float64("sfx", 1, "sound effect volume from 0 to 1")
+var mute = flag.Bool("mute", false, "run without opening an audio device")
+var pack_path = flag.String("pack", "", "asset pack overriding the built in resources, defaults to "+AssetPackName+" next to the executable")
+var settings_path = flag.String("settings", "", "settings file, defaults to "+SettingsFileName+" in the user config dir\nflags given override its settings")
+var bindings_path = flag.String("bindings", "", "key bindings file, defaults to "+BindingsFileName+" in the user config dir")
+
 type Game struct {
 	player          *Player
 	emitters        []*ParticleEmitter
+	resources       *ResourceManager
+	audio_manager   *AudioManager
+	input           *InputMap
+	render          *RenderQueue
+	lighting        *Lighting
 	texture_manager *TextureManager
 	background      *ebiten.Image
 	camera          Camera
 	enemies         []*Enemy
 	enemies_grid    SpatialGrid
+	world           *World
+	flow_field      *FlowField
+	pathfinder      *Pathfinder
+	spawner         *Spawner
+	boss            *Boss
+	reloader        *DevReloader
+	hud             *HUD
+	combat          *CombatEvents
+	damage_numbers  *DamageNumbers
+	hit_stop        int // ticks left frozen
+	ticks           int // survived so far
+	kills           int
+
+	initial_count      int
+	initial_archetypes []*EnemyArchetype
 }
 
 var game *Game
 
-func NewGame() *Game {
-	tm, err := NewTextureManager("./res/unknown.png")
+func NewGame(resources *ResourceManager, audio_manager *AudioManager, input *InputMap) *Game {
+	tm, err := NewTextureManager(resources, "unknown.png")
 	if err != nil {
 		panic(err)
 	}
 
-	err = tm.LoadTextures("./res/")
-	if err != nil {
-		panic(err)
+	texture_err := tm.LoadTextures(".")
+	if texture_err != nil && !*dev_mode {
+		panic(texture_err)
 	}
 
 	player := NewPlayer(Vector2{100, 100}, 100, tm)
-	camera := NewCamera(Vector2{960, 600}, &player.rect.pos)
+	player.debug = settings.Debug
+	camera := NewCamera(Vector2{ScreenWidth, ScreenHeight}, &player.rect.pos)
 
-	enemies_grid := NewSpatialGrid(100, 100, 32)
-	enemies := []*Enemy{}
-	for i := 0; i < 200; i++ {
-		enemies = append(enemies, NewEnemy(
-			Vector2{
-				(rand.Float64() - 0.5) * 2 * 500,
-				(rand.Float64() - 0.5) * 2 * 500,
-			},
-			tm,
-		))
-	}
+	world := NewWorld(100, 100)
+	world.FillRect(12, 2, 1, 14, true)
+	world.FillRect(4, 18, 16, 1, true)
+	world.FillRect(22, 8, 8, 1, true)
+	world.FillRect(22, 9, 1, 10, true)
+	world.FillRect(6, 6, 3, 3, true)
 
-	return &Game{
+	g := &Game{
 		player: player,
 		emitters: []*ParticleEmitter{
 			NewParticleEmitter(Vector2{100, 150}, 90, 120, 0.3, 0.5, 2, 6, color.RGBA{255, 30, 150, 255}),
 			NewParticleEmitter(Vector2{200, 200}, 60, 90, 0.6, 0.8, 2, 2, color.RGBA{30, 255, 150, 255}),
 			NewParticleEmitter(Vector2{300, 150}, 120, 150, 0.2, 0.4, 3, 3, color.RGBA{150, 30, 255, 255}),
 		},
+		resources:       resources,
+		audio_manager:   audio_manager,
+		input:           input,
+		render:          NewRenderQueue(),
+		lighting:        NewLighting(resources),
+		hud:             NewHUD(resources),
+		combat:          NewCombatEvents(),
+		damage_numbers:  NewDamageNumbers(),
 		texture_manager: tm,
 		background:      tm.GetTexture("background"),
 		camera:          camera,
-		enemies:         enemies,
-		enemies_grid:    enemies_grid,
+		enemies:         []*Enemy{},
+		enemies_grid:    NewSpatialGrid(100, 100, 32),
+		world:           world,
+		flow_field:      NewFlowField(world, FlowFieldBudget),
+		pathfinder:      NewPathfinder(NewNavGrid(world), PathfinderBudget),
+		spawner:         NewSpawner(),
+	}
+
+	g.combat.OnHit(func(e HitEvent) {
+		e.target.Flash(HitFlashTicks)
+		g.damage_numbers.Spawn(e.pos, e.damage, e.crit)
+		g.audio_manager.PlayAt("hit", e.pos)
+		if e.killed {
+			g.lighting.Flash(e.pos, ExplosionLightRadius, ExplosionLightColor, ExplosionLightTicks)
+		}
+		if settings.HitStop && e.crit {
+			g.hit_stop = HitStopTicks
+		}
+	})
+
+	// defaults for when res/data/waves.json is missing
+	g.initial_count = 200
+	g.initial_archetypes = []*EnemyArchetype{GruntArchetype, GruntArchetype, SwarmerArchetype, SkirmisherArchetype}
+	for i := 1; i <= 5; i++ {
+		g.spawner.Plan(i*30*FPS, SpawnWave(20+i*10, g.initial_archetypes))
+	}
+	g.spawner.Plan(3*60*FPS, SpawnBoss())
+
+	data_err := LoadData(g, resources, "data")
+	if data_err != nil && !*dev_mode {
+		panic(data_err)
+	}
+
+	// fail before the first frame rather than on the first shot
+	if *strict_mode {
+		if err := CheckReferences(tm); err != nil {
+			panic(err)
+		}
+		if fallbacks := resources.Fallbacks(); len(fallbacks) > 0 {
+			panic(fallbacks)
+		}
+	}
+
+	if *dev_mode {
+		g.reloader = NewDevReloader(g, resources.fsys, "data")
+		g.reloader.Report(".", texture_err)
+		g.reloader.Report("data", data_err)
+		g.reloader.Report(".", resources.Fallbacks())
+	} else {
+		for _, err := range resources.Fallbacks() {
+			log.Printf("using a placeholder for %s", err)
+		}
+	}
+
+	if err := g.audio_manager.PlayMusic("audio/music.wav"); err != nil {
+		log.Printf("no music: %s", err)
 	}
+
+	for len(g.enemies) < g.initial_count {
+		pos := Vector2{rand.Float64() * 1000, rand.Float64() * 1000}
+		if world.Collides(NewRect(pos, Vector2{EnemySize, EnemySize})) {
+			continue
+		}
+		archetype := g.initial_archetypes[rand.Intn(len(g.initial_archetypes))]
+		g.enemies = append(g.enemies, NewEnemy(pos, archetype, tm))
+	}
+
+	return g
 }
 
 func (g *Game) Update() error {
-	if ebiten.IsKeyPressed(ebiten.KeyQ) {
-		return ebiten.Termination
+	if g.input.JustPressed(ActionToggleDebug) {
+		g.player.debug = !g.player.debug
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
-		g.player.debug = !g.player.debug
+	if g.reloader != nil {
+		g.reloader.Update()
+	}
+
+	// the world holds still for a moment after big hits
+	if g.hit_stop > 0 {
+		g.hit_stop--
+		return nil
 	}
 
+	if g.player.health > 0 {
+		g.ticks++
+	}
 	g.player.Update()
 	g.camera.Update()
+	g.flow_field.Update(g.player.rect.pos.Add(g.player.rect.extents.Scale(0.5)))
+
+	if g.player.debug && g.input.JustPressed(ActionDebugPath) {
+		g.pathfinder.Request(
+			g.player.rect.pos.Add(g.player.rect.extents.Scale(0.5)),
+			g.camera.ScreenToWorld(viewport.Cursor()),
+			player_size,
+			nil,
+		)
+	}
+	g.pathfinder.Update()
+
+	// lets playtests skip straight to the boss
+	if g.player.debug && g.input.JustPressed(ActionSpawnBoss) {
+		g.spawner.Schedule(g.spawner.tick, SpawnBoss())
+	}
+	g.spawner.Update(g)
 	for _, enemy := range g.enemies {
 		enemy.Update()
 	}
+	if g.boss != nil {
+		g.boss.Update()
+		if g.boss.Removed() {
+			g.boss = nil
+		}
+	}
 
 	for _, emitter := range g.emitters {
 		dir := Vector2{x: (rand.Float64() - 0.5) * 2, y: (-rand.Float64() / 2) - 0.5}
 		emitter.Emit(dir)
 		emitter.Update()
 	}
+	g.damage_numbers.Update()
+	g.lighting.Update()
+
+	alive := g.enemies[:0]
+	for _, enemy := range g.enemies {
+		if !enemy.Removed() {
+			alive = append(alive, enemy)
+		}
+	}
+	g.enemies = alive
 
 	game.enemies_grid.Clear()
 
 	for _, enemy := range g.enemies {
-		game.enemies_grid.Insert(enemy)
+		if enemy.Alive() {
+			game.enemies_grid.Insert(enemy)
+		}
 	}
 
 	return nil
@@ -97,32 +253,138 @@ func (g *Game) Update() error {
 
 func (g *Game) Draw(screen *ebiten.Image) {
 	screen.Fill(color.RGBA{50, 50, 55, 255})
-	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Translate(-g.camera.rect.pos.x, -g.camera.rect.pos.y)
-	screen.DrawImage(g.background, op)
+	q := g.render
+	q.Begin(g.camera.rect)
+
+	// the ground layer keeps the order of submission
+	q.Submit(LayerGround, 0, g.background, func(screen *ebiten.Image) {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(-g.camera.rect.pos.x, -g.camera.rect.pos.y)
+		screen.DrawImage(g.background, op)
+	})
+	q.Submit(LayerGround, 1, nil, g.world.Draw)
+	if g.player.debug {
+		q.Submit(LayerGround, 2, nil, g.flow_field.DebugDraw)
+		q.Submit(LayerGround, 3, nil, g.pathfinder.DebugDraw)
+	}
 
 	for _, emitter := range g.emitters {
-		emitter.Draw(screen)
+		emitter.Submit(q)
 	}
-	g.player.Draw(screen)
+	g.player.Submit(q)
+	g.player.AddLights(g.lighting)
+	// the grid only has the living enemies, the few dying ones are checked
+	// one by one
+	in_view := g.enemies_grid.GetEnemiesInRect(q.View())
 	for _, enemy := range g.enemies {
-		enemy.Draw(screen)
+		if !enemy.Alive() {
+			in_view = append(in_view, enemy)
+		}
+	}
+	for _, enemy := range in_view {
+		if q.Cull(KindEnemy, enemy.Rect()) {
+			q.Submit(LayerEntities, enemy.cc.pos.y+enemy.cc.r, enemy.sprite, enemy.Draw)
+		}
+	}
+	q.CountCulled(KindEnemy, len(g.enemies)-len(in_view))
+	if g.boss != nil {
+		g.boss.Submit(q, g.player.debug)
+		g.boss.bullet_manager.AddLights(g.lighting, BossBulletLightColor)
 	}
 
-	DebugDrawEnemies(screen, game.enemies_grid.GetNearbyEnemies(game.player.rect.pos))
+	q.Submit(LayerOverlay, 0, nil, func(screen *ebiten.Image) {
+		g.damage_numbers.Draw(screen, g.hud.face)
+		DebugDrawEnemies(screen, game.enemies_grid.GetNearbyEnemies(game.player.rect.pos))
+		if g.player.debug {
+			for _, enemy := range g.enemies {
+				enemy.DebugDraw(screen)
+			}
+		}
+	})
+	q.Flush(screen, LayerEffects)
+	g.lighting.Draw(screen, g.camera.rect)
+	q.Flush(screen, LayerOverlay)
 
-	ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %f\nFPS: %f", ebiten.ActualTPS(), ebiten.ActualFPS()))
-}
+	if g.boss != nil {
+		g.boss.DrawHealthBar(screen)
+	}
+	g.hud.Draw(screen, g)
 
-func (g *Game) Layout(outsideWidth int, outsideHeight int) (int, int) {
-	return outsideWidth / 2, outsideHeight / 2
+	if g.reloader != nil {
+		g.reloader.Draw(screen)
+	}
+
+	ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %f\nFPS: %f", ebiten.ActualTPS(), ebiten.ActualFPS()))
+	if g.player.debug {
+		ebitenutil.DebugPrintAt(screen, q.Stats(), 0, 32)
+	}
 }
 
 func main() {
-	ebiten.SetWindowSize(1920, 1200)
+	flag.Parse()
+	if *dev_mode && *mods_dir == "" {
+		*mods_dir = "./res/"
+	}
+	assets, err := OpenAssets(*mods_dir, *pack_path)
+	if err != nil {
+		panic(err)
+	}
+	resources := NewResourceManager(assets)
+
+	if *validate_mode {
+		errs := Validate(resources)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("all resources ok")
+		return
+	}
+
+	if *settings_path == "" {
+		*settings_path, err = ConfigPath(SettingsFileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "settings are not saved:", err)
+		}
+	}
+	settings, err = LoadSettings(*settings_path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "using the default settings:", err)
+	}
+	settings.ApplyFlags()
+
+	// everything stays loaded for the whole run, so new games start right away
+	release := resources.Preload(resources.Index())
+	defer release()
+
+	// there can only be one audio context, so it outlives every game
+	var audio_context *audio.Context
+	if !*mute {
+		audio_context = audio.NewContext(SampleRate)
+	}
+	audio_manager := NewAudioManager(audio_context, resources)
+	defer audio_manager.Close()
+
+	if *bindings_path == "" {
+		*bindings_path, err = ConfigPath(BindingsFileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bindings are not saved:", err)
+		}
+	}
+	input, err := LoadInputMap(*bindings_path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "using the default bindings:", err)
+		input = DefaultInputMap()
+	}
+
+	// everything is timed in ticks against FPS
 	ebiten.SetTPS(FPS)
-	game = NewGame()
-	if err := ebiten.RunGame(game); err != nil {
+	ebiten.SetWindowSize(settings.WindowWidth, settings.WindowHeight)
+	settings.Apply(audio_manager)
+	scenes := NewSceneManager(resources, audio_manager, input, NewLoadingScene(resources))
+	if err := ebiten.RunGame(scenes); err != nil {
 		panic(err)
 	}
 }
@@ -71,12 +71,19 @@ func (e *ParticleEmitter) Update() {
 	}
 }
 
+func (e *ParticleEmitter) Submit(q *RenderQueue) {
+	if e.particles != nil {
+		q.Submit(LayerEffects, 0, nil, e.Draw)
+	}
+}
+
 func (e *ParticleEmitter) Draw(screen *ebiten.Image) {
-	cp := e.particles
-	for cp != nil {
+	for cp := e.particles; cp != nil; cp = cp.next {
+		if !game.render.CullPoint(KindParticle, cp.pos) {
+			continue
+		}
 		sp := cp.pos.Sub(game.camera.rect.pos)
 		vector.DrawFilledRect(screen, float32(sp.x), float32(sp.y), e.size_x, e.size_y, e.color, false)
-		cp = cp.next
 	}
 }
 
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"container/heap"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const PathfinderBudget = 2000
+const path_debug_history = 8
+
+// NavGrid is the walkability snapshot the A* searches run on. It is built
+// from the solid tiles of the world and has to be rebuilt when they change.
+type NavGrid struct {
+	world   *World
+	width   int
+	height  int
+	blocked []bool
+}
+
+func NewNavGrid(world *World) *NavGrid {
+	g := &NavGrid{
+		world:   world,
+		width:   world.width,
+		height:  world.height,
+		blocked: make([]bool, world.width*world.height),
+	}
+	g.Rebuild()
+	return g
+}
+
+func (g *NavGrid) Rebuild() {
+	copy(g.blocked, g.world.solid)
+}
+
+func (g *NavGrid) Walkable(x, y int) bool {
+	return x >= 0 && x < g.width && y >= 0 && y < g.height && !g.blocked[y*g.width+x]
+}
+
+type PathStatus int
+
+const (
+	PathQueued PathStatus = iota
+	PathSearching
+	PathFound
+	PathFailed
+	PathCancelled
+)
+
+type PathRequest struct {
+	start    Vector2
+	goal     Vector2
+	size     float64 // of the agent, the smoothed path leaves room for it
+	status   PathStatus
+	path     []Vector2
+	callback func(*PathRequest)
+	expanded int
+
+	goal_index int
+	open       path_queue
+	cost       map[int]int
+	parent     map[int]int
+	closed     map[int]bool
+}
+
+func (r *PathRequest) Done() bool {
+	return r.status == PathFound || r.status == PathFailed || r.status == PathCancelled
+}
+
+func (r *PathRequest) Cancel() {
+	if !r.Done() {
+		r.status = PathCancelled
+	}
+}
+
+// Pathfinder runs queued A* requests, expanding at most budget nodes per
+// Update so that expensive searches are spread over several ticks.
+type Pathfinder struct {
+	grid     *NavGrid
+	budget   int
+	requests []*PathRequest
+	history  []*PathRequest
+}
+
+func NewPathfinder(grid *NavGrid, budget int) *Pathfinder {
+	return &Pathfinder{
+		grid:     grid,
+		budget:   budget,
+		requests: []*PathRequest{},
+		history:  []*PathRequest{},
+	}
+}
+
+// Queues a search from start to goal for an agent of size. The callback, if
+// any, is called once the request is done, the returned request can also be
+// polled.
+func (p *Pathfinder) Request(start Vector2, goal Vector2, size float64, callback func(*PathRequest)) *PathRequest {
+	r := &PathRequest{
+		start:    start,
+		goal:     goal,
+		size:     size,
+		status:   PathQueued,
+		callback: callback,
+	}
+	p.requests = append(p.requests, r)
+	return r
+}
+
+func (p *Pathfinder) Update() {
+	budget := p.budget
+	for budget > 0 && len(p.requests) > 0 {
+		r := p.requests[0]
+		if r.status == PathQueued {
+			p.begin(r)
+		}
+		if r.status == PathSearching {
+			budget -= p.search(r, budget)
+		}
+		if r.Done() {
+			p.requests = p.requests[1:]
+			p.finish(r)
+		}
+	}
+}
+
+func (p *Pathfinder) begin(r *PathRequest) {
+	sx, sy := p.grid.world.PosToCell(r.start)
+	gx, gy := p.grid.world.PosToCell(r.goal)
+	if !p.grid.Walkable(sx, sy) || !p.grid.Walkable(gx, gy) {
+		r.status = PathFailed
+		return
+	}
+
+	start := sy*p.grid.width + sx
+	r.goal_index = gy*p.grid.width + gx
+	r.cost = map[int]int{start: 0}
+	r.parent = map[int]int{start: -1}
+	r.closed = map[int]bool{}
+	r.open = path_queue{{index: start, cost: 0, priority: p.heuristic(start, r.goal_index)}}
+	r.status = PathSearching
+}
+
+// Expands up to budget nodes and returns how many were used.
+func (p *Pathfinder) search(r *PathRequest, budget int) int {
+	used := 0
+	for used < budget {
+		if r.open.Len() == 0 {
+			r.status = PathFailed
+			return used
+		}
+
+		current := heap.Pop(&r.open).(path_node)
+		if r.closed[current.index] {
+			continue
+		}
+		r.closed[current.index] = true
+		r.expanded++
+		used++
+
+		if current.index == r.goal_index {
+			r.path = p.smooth(p.reconstruct(r), r.size)
+			r.status = PathFound
+			return used
+		}
+
+		cx := current.index % p.grid.width
+		cy := current.index / p.grid.width
+		for _, n := range flow_neighbours {
+			nx, ny := cx+n[0], cy+n[1]
+			if !p.grid.Walkable(nx, ny) {
+				continue
+			}
+
+			step := flow_cost_straight
+			if n[0] != 0 && n[1] != 0 {
+				if !p.grid.Walkable(cx+n[0], cy) || !p.grid.Walkable(cx, cy+n[1]) {
+					continue
+				}
+				step = flow_cost_diagonal
+			}
+
+			index := ny*p.grid.width + nx
+			cost := current.cost + step
+			if old, ok := r.cost[index]; ok && old <= cost {
+				continue
+			}
+			r.cost[index] = cost
+			r.parent[index] = current.index
+			heap.Push(&r.open, path_node{index: index, cost: cost, priority: cost + p.heuristic(index, r.goal_index)})
+		}
+	}
+	return used
+}
+
+// Octile distance, matches the straight/diagonal step costs.
+func (p *Pathfinder) heuristic(a, b int) int {
+	dx := a%p.grid.width - b%p.grid.width
+	dy := a/p.grid.width - b/p.grid.width
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	if dx < dy {
+		dx, dy = dy, dx
+	}
+	return flow_cost_straight*(dx-dy) + flow_cost_diagonal*dy
+}
+
+func (p *Pathfinder) reconstruct(r *PathRequest) []Vector2 {
+	cells := []int{}
+	for i := r.goal_index; i != -1; i = r.parent[i] {
+		cells = append(cells, i)
+	}
+
+	path := make([]Vector2, 0, len(cells)+1)
+	path = append(path, r.start)
+	// skip the start cell, the exact start position replaces it
+	for i := len(cells) - 2; i >= 1; i-- {
+		path = append(path, p.grid.world.CellCenter(cells[i]%p.grid.width, cells[i]/p.grid.width))
+	}
+	path = append(path, r.goal)
+	return path
+}
+
+// Drops every waypoint an agent of size can skip by walking in a straight
+// line.
+func (p *Pathfinder) smooth(path []Vector2, size float64) []Vector2 {
+	if len(path) <= 2 {
+		return path
+	}
+
+	res := []Vector2{path[0]}
+	anchor := 0
+	for anchor < len(path)-1 {
+		next := anchor + 1
+		for i := len(path) - 1; i > anchor+1; i-- {
+			if p.grid.world.BoxSight(path[anchor], path[i], size) {
+				next = i
+				break
+			}
+		}
+		res = append(res, path[next])
+		anchor = next
+	}
+	return res
+}
+
+func (p *Pathfinder) finish(r *PathRequest) {
+	// free the search state, only the result is kept around
+	r.open = nil
+	r.cost = nil
+	r.parent = nil
+	r.closed = nil
+
+	p.history = append(p.history, r)
+	if len(p.history) > path_debug_history {
+		p.history = p.history[1:]
+	}
+
+	if r.callback != nil {
+		r.callback(r)
+	}
+}
+
+func (p *Pathfinder) DebugDraw(screen *ebiten.Image) {
+	for _, r := range p.requests {
+		s := game.camera.WorldToScreen(r.start)
+		g := game.camera.WorldToScreen(r.goal)
+		vector.StrokeLine(screen, float32(s.x), float32(s.y), float32(g.x), float32(g.y), 1, color.RGBA{255, 255, 0, 80}, false)
+	}
+
+	for _, r := range p.history {
+		if r.status != PathFound {
+			continue
+		}
+		for i := 1; i < len(r.path); i++ {
+			a := game.camera.WorldToScreen(r.path[i-1])
+			b := game.camera.WorldToScreen(r.path[i])
+			vector.StrokeLine(screen, float32(a.x), float32(a.y), float32(b.x), float32(b.y), 1, color.RGBA{255, 160, 0, 255}, false)
+			vector.DrawFilledRect(screen, float32(b.x)-2, float32(b.y)-2, 4, 4, color.RGBA{255, 160, 0, 255}, false)
+		}
+	}
+}
+
+type path_node struct {
+	index    int
+	cost     int
+	priority int
+}
+
+type path_queue []path_node
+
+func (q path_queue) Len() int            { return len(q) }
+func (q path_queue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q path_queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *path_queue) Push(x interface{}) { *q = append(*q, x.(path_node)) }
+func (q *path_queue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
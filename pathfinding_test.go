@@ -0,0 +1,121 @@
+package main
+
+import "testing"
+
+// A 10 by 10 world with a wall down column 4 that leaves a gap at the bottom.
+func newTestWorld() *World {
+	w := NewWorld(10, 10)
+	w.FillRect(4, 0, 1, 8, true)
+	return w
+}
+
+func runPath(t *testing.T, p *Pathfinder, r *PathRequest) int {
+	t.Helper()
+	updates := 0
+	for !r.Done() {
+		if updates > 1000 {
+			t.Fatalf("request not done after %d updates", updates)
+		}
+		p.Update()
+		updates++
+	}
+	return updates
+}
+
+func TestPathAroundWall(t *testing.T) {
+	w := newTestWorld()
+	p := NewPathfinder(NewNavGrid(w), PathfinderBudget)
+	start, goal := w.CellCenter(1, 1), w.CellCenter(8, 1)
+
+	calls := 0
+	r := p.Request(start, goal, player_size, func(*PathRequest) { calls++ })
+	runPath(t, p, r)
+	if r.status != PathFound {
+		t.Fatalf("status = %v, want found", r.status)
+	}
+	if calls != 1 {
+		t.Errorf("callback called %d times, want once", calls)
+	}
+	if r.path[0] != start || r.path[len(r.path)-1] != goal {
+		t.Errorf("path runs from %v to %v, want %v to %v", r.path[0], r.path[len(r.path)-1], start, goal)
+	}
+	for i := 1; i < len(r.path); i++ {
+		if !w.BoxSight(r.path[i-1], r.path[i], player_size) {
+			t.Errorf("no room for the agent from %v to %v", r.path[i-1], r.path[i])
+		}
+	}
+}
+
+func TestPathSmoothingLeavesRoom(t *testing.T) {
+	w := newTestWorld()
+	p := NewPathfinder(NewNavGrid(w), PathfinderBudget)
+
+	// down the left of the wall and around its end, a line fits past the
+	// end of the wall but the agent does not
+	path := []Vector2{w.CellCenter(3, 0), w.CellCenter(3, 8), {4*TileSize - 1, 9 * TileSize}}
+	if cut := p.smooth(path, 0); len(cut) != 2 {
+		t.Errorf("a point kept %d waypoints, want 2", len(cut))
+	}
+	if room := p.smooth(path, player_size); len(room) != 3 {
+		t.Errorf("the agent kept %d waypoints, want 3", len(room))
+	}
+}
+
+func TestPathBudget(t *testing.T) {
+	w := newTestWorld()
+	p := NewPathfinder(NewNavGrid(w), 5)
+	r := p.Request(w.CellCenter(1, 1), w.CellCenter(8, 1), player_size, nil)
+
+	last, updates := 0, 0
+	for !r.Done() {
+		p.Update()
+		updates++
+		if r.expanded-last > 5 {
+			t.Fatalf("expanded %d nodes in one update, budget is 5", r.expanded-last)
+		}
+		last = r.expanded
+	}
+	if r.status != PathFound {
+		t.Fatalf("status = %v, want found", r.status)
+	}
+	if updates < 2 {
+		t.Errorf("search took %d updates, want it spread over several", updates)
+	}
+}
+
+func TestPathFails(t *testing.T) {
+	w := newTestWorld()
+	w.FillRect(4, 8, 1, 2, true)
+	p := NewPathfinder(NewNavGrid(w), PathfinderBudget)
+
+	walled := p.Request(w.CellCenter(1, 1), w.CellCenter(8, 1), player_size, nil)
+	runPath(t, p, walled)
+	if walled.status != PathFailed {
+		t.Errorf("walled off goal: status = %v, want failed", walled.status)
+	}
+
+	solid := p.Request(w.CellCenter(1, 1), w.CellCenter(4, 1), player_size, nil)
+	p.Update()
+	if solid.status != PathFailed || solid.expanded != 0 {
+		t.Errorf("goal in a wall: status = %v after %d nodes, want failed right away", solid.status, solid.expanded)
+	}
+}
+
+func TestPathCancel(t *testing.T) {
+	w := newTestWorld()
+	p := NewPathfinder(NewNavGrid(w), PathfinderBudget)
+	cancelled := p.Request(w.CellCenter(1, 1), w.CellCenter(8, 1), player_size, nil)
+	next := p.Request(w.CellCenter(1, 1), w.CellCenter(2, 2), player_size, nil)
+	cancelled.Cancel()
+
+	p.Update()
+	if cancelled.status != PathCancelled || cancelled.expanded != 0 {
+		t.Errorf("cancelled request: status = %v after %d nodes", cancelled.status, cancelled.expanded)
+	}
+	if next.status != PathFound {
+		t.Errorf("request after the cancelled one: status = %v, want found", next.status)
+	}
+	if len(p.requests) != 0 {
+		t.Errorf("%d requests left in the queue", len(p.requests))
+	}
+}
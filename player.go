@@ -5,7 +5,6 @@ import (
 	"math/rand"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 )
 
@@ -16,115 +15,76 @@ const (
 	right
 )
 
-const animation_timeout = 0.25 * FPS
+const muzzle_flash_frame = 1
 const emit_timeout = 1
 const player_size = 32
 
 type Player struct {
 	rect                   Rect
 	health                 int
+	max_health             int
 	xp                     int
 	lvl                    int
+	pending_levels         int // level ups waiting for an upgrade choice
 	sprite                 *ebiten.Image
 	speed                  float64
 	state                  PlayerState
 	animator               *Animator[PlayerState]
-	animation_task         *Task
 	moving_particle_emiter ParticleEmitter
+	muzzle_flash_emitter   ParticleEmitter
 	emit_task              *Task
-	attack_timer           int
 	bullet_manager         BulletManager
+	upgrades               []*Upgrade // taken so far, in order
 	debug                  bool
 	dir                    dir
 }
 
 func NewPlayer(pos Vector2, health int, tm *TextureManager) *Player {
-	var idle_sprites = []*ebiten.Image{
-		tm.GetTexture("robot_idle_0"),
-		tm.GetTexture("robot_idle_1"),
-		tm.GetTexture("robot_idle_2"),
-		tm.GetTexture("robot_idle_3"),
-	}
-
-	var moving_spites = []*ebiten.Image{
-		tm.GetTexture("robot_moving_0"),
-		tm.GetTexture("robot_moving_1"),
-		tm.GetTexture("robot_moving_2"),
-		tm.GetTexture("robot_moving_3"),
-	}
-
-	var attack_sprites = []*ebiten.Image{
-		tm.GetTexture("robot_attack_0"),
-		tm.GetTexture("robot_attack_1"),
-		tm.GetTexture("robot_attack_2"),
-		tm.GetTexture("robot_attack_3"),
-	}
-
-	var attack_moving_sprites = []*ebiten.Image{
-		tm.GetTexture("robot_attack_moving_0"),
-		tm.GetTexture("robot_attack_moving_1"),
-		tm.GetTexture("robot_attack_moving_2"),
-		tm.GetTexture("robot_attack_moving_3"),
-	}
-
 	p := &Player{
 		rect:                   NewRect(pos, Vector2{float64(player_size), float64(player_size)}),
 		health:                 health,
+		max_health:             health,
 		xp:                     0,
 		lvl:                    0,
-		sprite:                 idle_sprites[0],
+		sprite:                 tm.GetFrameByName("robot_sheet", "robot_idle_0"),
 		dir:                    left,
 		speed:                  1.25,
 		state:                  PlayerIdle,
-		attack_timer:           0,
 		moving_particle_emiter: *NewParticleEmitter(pos.Add(Vector2{float64(player_size) - 10, float64(player_size) - 4}), 45, 60, 0.4, 0.6, 4, 4, color.RGBA{60, 60, 75, 255}),
-		bullet_manager:         *NewBulletManager(pos.Add(Vector2{-16, 0}), 120, 3, 69, tm),
+		muzzle_flash_emitter:   *NewParticleEmitter(pos, 6, 12, 0.8, 1.6, 2, 2, color.RGBA{255, 220, 120, 255}),
+		bullet_manager:         *NewBulletManager(pos.Add(Vector2{-16, 0}), SecondsToTicks(weapons["blaster"].Lifetime), weapons["blaster"].Velocity, weapons["blaster"].Damage, tm),
 		debug:                  false,
 	}
 
 	p.animator = NewAnimator[PlayerState](&p.sprite)
-	p.animator.AddAnimation(
-		PlayerIdle,
-		NewAnimation(
-			idle_sprites, animation_timeout,
-		),
-	)
-
-	p.animator.AddAnimation(
-		PlayerMoving,
-		NewAnimation(
-			moving_spites, animation_timeout,
-		),
-	)
-
-	p.animator.AddAnimation(
-		PlayerAttacking,
-		NewAnimation(
-			attack_sprites, animation_timeout,
-		),
-	)
-
-	p.animator.AddAnimation(
-		PlayerMovingAttacking,
-		NewAnimation(
-			attack_moving_sprites, animation_timeout,
-		),
-	)
+	p.animator.AddAnimation(PlayerIdle, tm.GetAnimation("robot_sheet", "idle"))
+	p.animator.AddAnimation(PlayerMoving, tm.GetAnimation("robot_sheet", "moving"))
+	p.animator.AddAnimation(PlayerAttacking, tm.GetAnimation("robot_sheet", "attack").SetMode(PlaybackOnce))
+	p.animator.AddAnimation(PlayerMovingAttacking, tm.GetAnimation("robot_sheet", "attack_moving").SetMode(PlaybackOnce))
+
+	p.animator.AddTransition(PlayerIdle, PlayerMoving, false)
+	p.animator.AddTransition(PlayerIdle, PlayerAttacking, false)
+	p.animator.AddTransition(PlayerMoving, PlayerIdle, false)
+	p.animator.AddTransition(PlayerMoving, PlayerMovingAttacking, false)
+	// switching between standing and moving mid attack keeps the attack going
+	p.animator.AddTransition(PlayerAttacking, PlayerMovingAttacking, true)
+	p.animator.AddTransition(PlayerAttacking, PlayerIdle, false)
+	p.animator.AddTransition(PlayerMovingAttacking, PlayerAttacking, true)
+	p.animator.AddTransition(PlayerMovingAttacking, PlayerMoving, false)
+
+	p.animator.Then(PlayerAttacking, PlayerIdle)
+	p.animator.Then(PlayerMovingAttacking, PlayerMoving)
+	p.animator.OnFrame(PlayerAttacking, muzzle_flash_frame, p.MuzzleFlash)
+	p.animator.OnFrame(PlayerMovingAttacking, muzzle_flash_frame, p.MuzzleFlash)
 
 	p.animator.SetAnimation(PlayerIdle)
 
-	p.animation_task = NewTask(1, func() {
-		if p.animator.ckey != p.state {
-			p.animator.SetAnimation(p.state)
-		}
-
-		p.animator.Update()
-	})
-
 	p.emit_task = NewTask(emit_timeout, func() {
 		p.Emit()
 	})
 
+	p.bullet_manager.hit = p.BulletHit
+
 	return p
 }
 
@@ -144,9 +104,42 @@ func (p Player) Draw(screen *ebiten.Image) {
 	if p.debug {
 		vector.StrokeRect(screen, float32(screen_pos.x), float32(screen_pos.y), float32(p.rect.extents.x), float32(p.rect.extents.y), 1, color.RGBA{255, 0, 0, 255}, false)
 	}
+}
 
-	p.moving_particle_emiter.Draw(screen)
-	p.bullet_manager.Draw(screen, p.debug)
+// The sprite is sorted by the players feet, particles and bullets go on
+// top.
+func (p *Player) TakeUpgrade(u *Upgrade) {
+	p.upgrades = append(p.upgrades, u)
+	if u.apply != nil {
+		u.apply(p)
+	}
+	if u.weapon != nil {
+		u.weapon(&p.bullet_manager)
+	}
+}
+
+// Switches to the weapon w with the upgrades taken so far on top.
+func (p *Player) SetWeapon(w WeaponData) {
+	p.bullet_manager.SetWeapon(w)
+	for _, u := range p.upgrades {
+		if u.weapon != nil {
+			u.weapon(&p.bullet_manager)
+		}
+	}
+}
+
+func (p *Player) Submit(q *RenderQueue) {
+	if q.Cull(KindPlayer, p.rect) {
+		q.Submit(LayerEntities, p.rect.pos.y+p.rect.extents.y, p.sprite, p.Draw)
+	}
+	p.moving_particle_emiter.Submit(q)
+	p.muzzle_flash_emitter.Submit(q)
+	p.bullet_manager.Submit(q, p.debug)
+}
+
+func (p *Player) AddLights(l *Lighting) {
+	l.Add(p.rect.pos.Add(p.rect.extents.Scale(0.5)), PlayerLightRadius, PlayerLightColor)
+	p.bullet_manager.AddLights(l, BulletLightColor)
 }
 
 func (p *Player) Shoot() {
@@ -160,14 +153,70 @@ func (p *Player) Shoot() {
 	dir.y = (rand.Float64() - 0.5) * 2
 
 	p.bullet_manager.Shoot(dir)
+	game.lighting.Flash(p.bullet_manager.pos, MuzzleLightRadius, PlayerLightColor, MuzzleLightTicks)
+	game.audio_manager.PlayAt("shoot", p.rect.pos)
 
-	if p.state == PlayerMoving {
-		p.state = PlayerMovingAttacking
+	// shooting again restarts the attack animation
+	if p.state == PlayerMoving || p.state == PlayerMovingAttacking {
+		p.animator.SetAnimation(PlayerMovingAttacking)
 	} else {
-		p.state = PlayerAttacking
+		p.animator.SetAnimation(PlayerAttacking)
+	}
+	p.state = p.animator.Current()
+}
+
+func (p *Player) SetState(state PlayerState) {
+	p.animator.Play(state)
+	p.state = p.animator.Current()
+}
+
+func (p *Player) MuzzleFlash() {
+	dir := Vector2{-1, 0}
+	pos := p.bullet_manager.pos.Add(Vector2{BulletSize / 2, BulletSize / 2})
+	if p.dir == right {
+		dir.x = 1
+	}
+	p.muzzle_flash_emitter.pos = pos
+	for i := 0; i < 6; i++ {
+		p.muzzle_flash_emitter.Emit(dir.Add(Vector2{0, (rand.Float64() - 0.5) * 1.5}))
+	}
+}
+
+func (p *Player) BulletHit(b *Bullet) bool {
+	bc := CircleCollider{pos: b.Center(), r: BulletSize / 2}
+	for _, enemy := range game.enemies_grid.GetNearbyEnemies(bc.pos) {
+		if enemy.Alive() && enemy.cc.Collides(bc) {
+			game.combat.Hit(enemy, bc.pos, b.damage)
+			return true
+		}
+	}
+	if game.boss != nil && game.boss.Alive() && game.boss.cc.Collides(bc) {
+		game.combat.Hit(game.boss, bc.pos, b.damage)
+		return true
+	}
+	return false
+}
+
+// Experience needed to get from lvl to the next level.
+func XPToNext(lvl int) int {
+	return 100 + 50*lvl
+}
+
+func (p *Player) AddXP(xp int) {
+	p.xp += xp
+	for p.xp >= XPToNext(p.lvl) {
+		p.xp -= XPToNext(p.lvl)
+		p.lvl++
+		p.pending_levels++
+		game.audio_manager.Play("level_up")
 	}
+}
 
-	p.attack_timer = 2 * animation_timeout
+func (p *Player) TakeDamage(damage int) {
+	p.health -= damage
+	if p.health < 0 {
+		p.health = 0
+	}
 }
 
 func (p *Player) Emit() {
@@ -192,56 +241,39 @@ func (p *Player) Emit() {
 }
 
 func (p *Player) Update() {
-	diff := Vector2{0, 0}
-	move := false
-	if ebiten.IsKeyPressed(ebiten.KeyW) {
-		diff.y = -1
-		move = true
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyS) {
-		diff.y = 1
-		move = true
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyA) {
-		diff.x = -1
-		move = true
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyD) {
-		diff.x = 1
-		move = true
-	}
-
-	p.animation_task.Update()
+	diff := game.input.Movement()
+	move := !diff.IsZero()
 
 	if move {
 		p.Move(diff)
 		p.emit_task.Update()
-	} else if p.attack_timer == 0 {
-		p.state = PlayerIdle
-	}
-
-	if p.attack_timer > 0 {
-		p.attack_timer -= 1
+	} else if p.state == PlayerMovingAttacking {
+		p.SetState(PlayerAttacking)
+	} else if p.state == PlayerMoving {
+		p.SetState(PlayerIdle)
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+	if game.input.JustPressed(ActionFire) {
 		p.Shoot()
 	}
 
-	p.animation_task.Update()
+	p.animator.Update()
+	p.state = p.animator.Current()
 
 	p.moving_particle_emiter.Update()
+	p.muzzle_flash_emitter.Update()
 	p.bullet_manager.Update()
 }
 
 func (p *Player) Move(dir Vector2) {
-	if p.attack_timer > 0 {
-		p.state = PlayerMovingAttacking
+	if p.state == PlayerAttacking || p.state == PlayerMovingAttacking {
+		p.SetState(PlayerMovingAttacking)
 	} else {
-		p.state = PlayerMoving
+		p.SetState(PlayerMoving)
 	}
 
-	p.rect.pos.AddEq(dir.Norm().Scale(p.speed))
+	// dir is shorter than 1 for a half tilted stick
+	game.world.MoveRect(&p.rect, dir.Scale(p.speed))
 
 	if dir.x < 0 {
 		p.dir = left
@@ -24,6 +24,11 @@ func (r Rect) Contains(o Rect) bool {
 		r.pos.y <= o.pos.y && o.pos.y+o.extents.y <= r.pos.y+r.extents.y)
 }
 
+func (r Rect) ContainsPoint(p Vector2) bool {
+	return r.pos.x <= p.x && p.x < r.pos.x+r.extents.x &&
+		r.pos.y <= p.y && p.y < r.pos.y+r.extents.y
+}
+
 func (r *Rect) ResolveX(o Rect, mov Vector2) {
 	if mov.x > 0 {
 		r.pos.x = o.pos.x - r.extents.x
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Layers are drawn bottom to top, within a layer the commands are drawn by
+// ascending key.
+type Layer int
+
+const (
+	LayerGround   Layer = iota
+	LayerEntities       // keyed by the y of their feet, so lower ones overlap
+	LayerProjectiles
+	LayerEffects
+	LayerOverlay
+)
+
+// Entities and projectiles are keyed by depth, draws less than this many
+// pixels apart count as level so they can be grouped by image.
+const DepthBucket = 8
+
+// The key to sort by before the image, the depth bucket for the layers
+// keyed by depth and the key itself for the others.
+func (l Layer) bucket(key float64) float64 {
+	if l == LayerEntities || l == LayerProjectiles {
+		return math.Floor(key / DepthBucket)
+	}
+	return key
+}
+
+// how far outside the camera things are still drawn, so nothing pops in
+// at the edges
+const CullMargin = 32
+
+// what the culling is counted by
+type EntityKind int
+
+const (
+	KindPlayer EntityKind = iota
+	KindEnemy
+	KindBoss
+	KindBullet
+	KindParticle
+	kind_count
+)
+
+var kind_names = [kind_count]string{"player", "enemies", "boss", "bullets", "particles"}
+
+type DrawCommand struct {
+	layer Layer
+	key   float64
+	batch int // commands drawing from the same image share one
+	draw  func(screen *ebiten.Image)
+}
+
+// RenderQueue collects the draws of a frame in world space, culls what is
+// outside the camera and draws the rest in order.
+type RenderQueue struct {
+	cmds    []DrawCommand
+	view    Rect
+	batches map[*ebiten.Image]int
+	drawn   [kind_count]int
+	total   [kind_count]int
+}
+
+func NewRenderQueue() *RenderQueue {
+	return &RenderQueue{batches: map[*ebiten.Image]int{}}
+}
+
+// Starts a frame seen through the camera rect.
+func (q *RenderQueue) Begin(camera Rect) {
+	q.cmds = q.cmds[:0]
+	q.view = NewRect(
+		camera.pos.Sub(Vector2{CullMargin, CullMargin}),
+		camera.extents.Add(Vector2{2 * CullMargin, 2 * CullMargin}),
+	)
+	for image := range q.batches {
+		delete(q.batches, image)
+	}
+	q.drawn = [kind_count]int{}
+	q.total = [kind_count]int{}
+}
+
+func (q *RenderQueue) View() Rect {
+	return q.view
+}
+
+// Reports whether something of kind covering r is in view, and counts it.
+func (q *RenderQueue) Cull(kind EntityKind, r Rect) bool {
+	return q.count(kind, q.view.Intersects(r))
+}
+
+func (q *RenderQueue) CullPoint(kind EntityKind, p Vector2) bool {
+	return q.count(kind, q.view.ContainsPoint(p))
+}
+
+func (q *RenderQueue) count(kind EntityKind, visible bool) bool {
+	q.total[kind]++
+	if visible {
+		q.drawn[kind]++
+	}
+	return visible
+}
+
+// Counts things that were culled without being looked at, like the
+// enemies outside the cells in view.
+func (q *RenderQueue) CountCulled(kind EntityKind, count int) {
+	q.total[kind] += count
+}
+
+// Drawn and total count of every kind, for the debug view.
+func (q *RenderQueue) Stats() string {
+	parts := []string{}
+	for kind := EntityKind(0); kind < kind_count; kind++ {
+		parts = append(parts, fmt.Sprintf("%s %d/%d", kind_names[kind], q.drawn[kind], q.total[kind]))
+	}
+	return "drawn " + strings.Join(parts, "  ")
+}
+
+// image is what draw draws from, nil when it does not draw an image.
+func (q *RenderQueue) Submit(layer Layer, key float64, image *ebiten.Image, draw func(screen *ebiten.Image)) {
+	batch, ok := q.batches[image]
+	if !ok {
+		batch = len(q.batches)
+		q.batches[image] = batch
+	}
+	q.cmds = append(q.cmds, DrawCommand{layer: layer, key: key, batch: batch, draw: draw})
+}
+
+// Sorts and draws everything submitted up to and including the last layer,
+// the layers above stay queued for the next Flush. Ebiten merges consecutive
+// draws from the same image, so within a depth bucket the draws are kept
+// together by image.
+func (q *RenderQueue) Flush(screen *ebiten.Image, last Layer) {
+	sort.SliceStable(q.cmds, func(i, j int) bool {
+		a, b := q.cmds[i], q.cmds[j]
+		if a.layer != b.layer {
+			return a.layer < b.layer
+		}
+		if ka, kb := a.layer.bucket(a.key), b.layer.bucket(b.key); ka != kb {
+			return ka < kb
+		}
+		if a.batch != b.batch {
+			return a.batch < b.batch
+		}
+		return a.key < b.key
+	})
+	drawn := 0
+	for _, cmd := range q.cmds {
+		if cmd.layer > last {
+			break
+		}
+		cmd.draw(screen)
+		drawn++
+	}
+	q.cmds = append(q.cmds[:0], q.cmds[drawn:]...)
+}
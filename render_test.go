@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestRenderQueueOrder(t *testing.T) {
+	q := NewRenderQueue()
+	q.Begin(NewRect(Vector2{0, 0}, Vector2{ScreenWidth, ScreenHeight}))
+	a, b := ebiten.NewImage(1, 1), ebiten.NewImage(1, 1)
+
+	order := []string{}
+	submit := func(name string, layer Layer, key float64, image *ebiten.Image) {
+		q.Submit(layer, key, image, func(*ebiten.Image) {
+			order = append(order, name)
+		})
+	}
+	submit("a1", LayerEntities, 101, a)
+	submit("b1", LayerEntities, 102, b)
+	submit("a2", LayerEntities, 103, a)
+	submit("b2", LayerEntities, 100+DepthBucket, b)
+	submit("world", LayerGround, 1, nil)
+	submit("background", LayerGround, 0, b)
+	submit("overlay", LayerOverlay, 0, nil)
+	q.Flush(nil, LayerEntities)
+
+	// within a depth bucket the draws are grouped by image, the ground keeps
+	// its exact order
+	want := []string{"background", "world", "a1", "a2", "b1", "b2"}
+	if len(order) != len(want) {
+		t.Fatalf("drew %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("drew %v, want %v", order, want)
+		}
+	}
+
+	q.Flush(nil, LayerOverlay)
+	if order[len(order)-1] != "overlay" {
+		t.Errorf("the overlay was not drawn by the second flush")
+	}
+}
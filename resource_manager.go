@@ -1,29 +1,97 @@
 package main
 
 import (
-	"os"
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 )
 
+// TextureManager keeps textures, sprite sheets and their frames by name.
+// The images themselves are owned by the ResourceManager, file paths are
+// relative to the root of its file system.
 type TextureManager struct {
+	res       *ResourceManager
 	resources map[string]*ebiten.Image
+	sheets    map[string]*SpriteSheet
+	sources   map[string]*ebiten.Image // images acquired from res, by file path
+	missing   map[string]bool          // every key that got the unknown texture
 	unknown   *ebiten.Image
 }
 
-func NewTextureManager(unknown_path string) (*TextureManager, error) {
-	uknown, _, err := ebitenutil.NewImageFromFile(unknown_path)
-	return &TextureManager{
+type LoadError struct {
+	path string
+	err  error
+}
+
+func (e *LoadError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.err
+}
+
+// Every load error of a directory, so one broken file doesnt hide the rest.
+type LoadErrors []*LoadError
+
+func (e LoadErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func NewTextureManager(res *ResourceManager, unknown_path string) (*TextureManager, error) {
+	r := &TextureManager{
+		res:       res,
 		resources: make(map[string]*ebiten.Image),
-		unknown:   uknown,
-	}, err
+		sheets:    make(map[string]*SpriteSheet),
+		sources:   make(map[string]*ebiten.Image),
+		missing:   make(map[string]bool),
+	}
+	unknown, err := r.loadImage(unknown_path)
+	if errors.Is(err, fs.ErrNotExist) {
+		unknown = NewCheckerboard(16, 4)
+	} else if err != nil {
+		return nil, err
+	}
+	r.unknown = unknown
+	return r, nil
+}
+
+// Magenta and black, so missing textures stand out.
+func NewCheckerboard(size int, cell int) *ebiten.Image {
+	img := ebiten.NewImage(size, size)
+	img.Fill(color.RGBA{0, 0, 0, 255})
+	for y := 0; y < size; y += cell {
+		for x := (y / cell % 2) * cell; x < size; x += 2 * cell {
+			img.SubImage(image.Rect(x, y, x+cell, y+cell)).(*ebiten.Image).Fill(color.RGBA{255, 0, 255, 255})
+		}
+	}
+	return img
+}
+
+// Every key requested so far that fell back to the unknown texture.
+func (r TextureManager) Missing() []string {
+	keys := make([]string, 0, len(r.missing))
+	for key := range r.missing {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (r *TextureManager) LoadTexture(key string, path string) error {
-	tex, _, err := ebitenutil.NewImageFromFile(path)
+	tex, err := r.loadImage(path)
 	if err != nil {
 		return err
 	} else {
@@ -32,30 +100,72 @@ func (r *TextureManager) LoadTexture(key string, path string) error {
 	}
 }
 
-func (r *TextureManager) LoadTextures(dir string) error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
+// Images are only ever acquired once, a sheet and its plain texture share
+// the same image.
+func (r *TextureManager) loadImage(file_path string) (*ebiten.Image, error) {
+	source := path.Clean(file_path)
+	if tex, ok := r.sources[source]; ok {
+		return tex, nil
 	}
-	dir = path.Join(cwd, dir)
+	if _, err := r.res.Acquire(file_path); err != nil {
+		r.res.Release(file_path)
+		return nil, err
+	}
+	tex := GetResource[*ebiten.Image](r.res, file_path)
+	r.sources[source] = tex
+	return tex, nil
+}
 
-	entries, err := os.ReadDir(dir)
+// Writes the new contents of an image file into the already loaded image,
+// everything holding on to it (or sub images of it) sees the change. Files
+// that were not loaded before are loaded as new.
+func (r *TextureManager) ReloadTexture(file_path string) error {
+	if _, ok := r.sources[path.Clean(file_path)]; !ok {
+		return r.LoadFile(file_path)
+	}
+	if err := r.res.Reload(file_path); err != nil {
+		return &LoadError{file_path, err}
+	}
+	return nil
+}
+
+func (r *TextureManager) LoadTextures(dir string) error {
+	entries, err := fs.ReadDir(r.res.fsys, dir)
 	if err != nil {
 		return err
 	}
 
+	errs := LoadErrors{}
 	for _, entry := range entries {
 		if !entry.IsDir() {
-			name := entry.Name()
-			if strings.HasSuffix(name, ".png") {
-				key := strings.Split(name, ".")[0]
-				err := r.LoadTexture(key, path.Join(dir, name))
-				if err != nil {
-					return err
-				}
+			if err := r.LoadFile(path.Join(dir, entry.Name())); err != nil {
+				errs = append(errs, err.(*LoadError))
 			}
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Loads a single resource file by its extension, other files are ignored.
+// Errors are always a *LoadError.
+func (r *TextureManager) LoadFile(file_path string) error {
+	name := path.Base(file_path)
+	key := strings.Split(name, ".")[0]
+	var err error
+	switch {
+	case strings.HasSuffix(name, ".png"):
+		err = r.LoadTexture(key, file_path)
+	case strings.HasSuffix(name, ".aseprite") || strings.HasSuffix(name, ".ase"):
+		err = r.LoadAseprite(key, file_path)
+	case strings.HasSuffix(name, SheetManifestSuffix):
+		err = r.LoadSpriteSheet(key, file_path)
+	}
+	if err != nil {
+		return &LoadError{file_path, err}
+	}
 	return nil
 }
 
@@ -63,11 +173,106 @@ func (r *TextureManager) AddTexture(key string, tex *ebiten.Image) {
 	r.resources[key] = tex
 }
 
+// Like GetTexture, for textures that are optional.
+func (r TextureManager) LookupTexture(key string) (*ebiten.Image, bool) {
+	tex, ok := r.resources[key]
+	return tex, ok
+}
+
 func (r TextureManager) GetTexture(key string) *ebiten.Image {
 	tex, ok := r.resources[key]
 	if !ok {
+		r.missing["texture "+key] = true
 		return r.unknown
 	} else {
 		return tex
 	}
 }
+
+// Loads a sprite sheet manifest and the image it references, relative to
+// the manifest. Every frame also becomes a texture under its frame name.
+func (r *TextureManager) LoadSpriteSheet(key string, manifest_path string) error {
+	data, err := fs.ReadFile(r.res.fsys, manifest_path)
+	if err != nil {
+		return err
+	}
+
+	manifest, frames, err := parseSheetManifest(data)
+	if err != nil {
+		return err
+	}
+
+	img, err := r.loadImage(path.Join(path.Dir(manifest_path), manifest.Meta.Image))
+	if err != nil {
+		return err
+	}
+
+	sheet, err := NewSpriteSheet(img, manifest, frames)
+	if err != nil {
+		return err
+	}
+
+	r.sheets[key] = sheet
+	for _, frame := range sheet.frames {
+		r.resources[frame.name] = frame.image
+	}
+	return nil
+}
+
+// Loads an Aseprite file as a sprite sheet, its tags become animations and
+// its frames textures named key_0, key_1...
+func (r *TextureManager) LoadAseprite(key string, file_path string) error {
+	f, err := r.res.fsys.Open(file_path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	file, err := ParseAseprite(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+
+	sheet := NewSpriteSheetFromAseprite(key, file)
+	r.sheets[key] = sheet
+	for _, frame := range sheet.frames {
+		r.resources[frame.name] = frame.image
+	}
+	return nil
+}
+
+func (r TextureManager) GetSheet(key string) (*SpriteSheet, bool) {
+	sheet, ok := r.sheets[key]
+	return sheet, ok
+}
+
+func (r TextureManager) GetFrame(sheet string, index int) *ebiten.Image {
+	s, ok := r.sheets[sheet]
+	if !ok || index < 0 || index >= s.Len() {
+		r.missing[fmt.Sprintf("sheet %s frame %d", sheet, index)] = true
+		return r.unknown
+	}
+	return s.Frame(index)
+}
+
+func (r TextureManager) GetFrameByName(sheet string, name string) *ebiten.Image {
+	if s, ok := r.sheets[sheet]; ok {
+		if frame, ok := s.FrameByName(name); ok {
+			return frame
+		}
+	}
+	r.missing[fmt.Sprintf("sheet %s frame %s", sheet, name)] = true
+	return r.unknown
+}
+
+// Builds the animation of a tagged frame range, a missing sheet or tag
+// gives a still of the unknown texture.
+func (r TextureManager) GetAnimation(sheet string, tag string) *Animation {
+	if s, ok := r.sheets[sheet]; ok {
+		if animation, ok := s.Animation(tag); ok {
+			return animation
+		}
+	}
+	r.missing[fmt.Sprintf("sheet %s tag %s", sheet, tag)] = true
+	return NewAnimation([]*ebiten.Image{r.unknown}, 1)
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"golang.org/x/image/font/basicfont"
+)
+
+const SampleRate = 44100
+
+// ResourceLoader turns the bytes of a file into a resource. decode may run on
+// a loader goroutine, finalize always runs on the game thread, so anything
+// touching ebiten belongs there. finalize and replace are optional, replace
+// reloads a resource in place.
+type ResourceLoader struct {
+	name        string
+	extensions  []string
+	decode      func(data []byte) (any, error)
+	finalize    func(value any) (any, error)
+	replace     func(old any, value any) (any, error)
+	placeholder func() any
+}
+
+type Resource struct {
+	path   string
+	loader *ResourceLoader
+	value  any
+	refs   int
+	loaded bool
+	err    error // why the placeholder is used instead
+}
+
+// Decoded PCM, 16 bit signed little endian stereo at SampleRate.
+type AudioClip struct {
+	pcm []byte
+}
+
+type resource_result struct {
+	path  string
+	value any
+	err   error
+}
+
+// ResourceManager loads any kind of resource by its file path, relative to
+// the root of its file system. Resources are reference counted and dropped
+// once the last reference is released. Files that fail to load are replaced
+// by the placeholder of their kind and reported by Fallbacks.
+type ResourceManager struct {
+	fsys      fs.FS
+	loaders   []*ResourceLoader
+	resources map[string]*Resource
+	results   chan resource_result
+	pending   int
+	total     int
+	done      int
+}
+
+func NewResourceManager(fsys fs.FS) *ResourceManager {
+	r := &ResourceManager{
+		fsys:      fsys,
+		loaders:   []*ResourceLoader{},
+		resources: make(map[string]*Resource),
+		results:   make(chan resource_result, 64),
+	}
+	r.RegisterLoader(ImageLoader)
+	r.RegisterLoader(AudioLoader)
+	r.RegisterLoader(FontLoader)
+	r.RegisterLoader(DataLoader)
+	r.RegisterLoader(ShaderLoader)
+	return r
+}
+
+// Later loaders take precedence for extensions they share with earlier ones.
+func (r *ResourceManager) RegisterLoader(loader *ResourceLoader) {
+	r.loaders = append([]*ResourceLoader{loader}, r.loaders...)
+}
+
+func (r *ResourceManager) LoaderFor(file_path string) *ResourceLoader {
+	ext := strings.ToLower(path.Ext(file_path))
+	for _, loader := range r.loaders {
+		for _, e := range loader.extensions {
+			if e == ext {
+				return loader
+			}
+		}
+	}
+	return nil
+}
+
+// Lists every file some loader knows how to load.
+func (r *ResourceManager) Index() []string {
+	paths := []string{}
+	fs.WalkDir(r.fsys, ".", func(file_path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && r.LoaderFor(file_path) != nil {
+			paths = append(paths, file_path)
+		}
+		return nil
+	})
+	return paths
+}
+
+func (r *ResourceManager) entry(file_path string) (*Resource, error) {
+	file_path = path.Clean(file_path)
+	if res, ok := r.resources[file_path]; ok {
+		return res, nil
+	}
+	loader := r.LoaderFor(file_path)
+	if loader == nil {
+		return nil, fmt.Errorf("%s: no loader for %q files", file_path, path.Ext(file_path))
+	}
+	res := &Resource{path: file_path, loader: loader}
+	r.resources[file_path] = res
+	return res, nil
+}
+
+// Takes a reference to a resource, loading it right away if it is not
+// loaded yet. Every Acquire needs a matching Release.
+func (r *ResourceManager) Acquire(file_path string) (*Resource, error) {
+	res, err := r.entry(file_path)
+	if err != nil {
+		return nil, err
+	}
+	res.refs++
+	if !res.loaded {
+		value, err := r.read(res.path, res.loader)
+		r.store(res, value, err)
+	}
+	return res, res.err
+}
+
+func (r *ResourceManager) Release(file_path string) {
+	res, ok := r.resources[path.Clean(file_path)]
+	if !ok {
+		return
+	}
+	res.refs--
+	if res.refs <= 0 {
+		delete(r.resources, res.path)
+	}
+}
+
+func (r *ResourceManager) read(file_path string, loader *ResourceLoader) (any, error) {
+	data, err := fs.ReadFile(r.fsys, file_path)
+	if err != nil {
+		return nil, err
+	}
+	return loader.decode(data)
+}
+
+func (r *ResourceManager) store(res *Resource, value any, err error) {
+	res.loaded = true
+	if err == nil && res.loader.finalize != nil {
+		value, err = res.loader.finalize(value)
+	}
+	res.err = err
+	if err != nil {
+		res.value = res.loader.placeholder()
+		return
+	}
+	res.value = value
+}
+
+// Starts loading resources in the background, each one is acquired once and
+// stays loaded until the returned release is called. Call Update every tick
+// to collect them and Progress to show how far it got.
+func (r *ResourceManager) Preload(paths []string) (release func()) {
+	acquired := []string{}
+	queued := []*Resource{}
+	for _, file_path := range paths {
+		res, err := r.entry(file_path)
+		if err != nil {
+			continue
+		}
+		res.refs++
+		acquired = append(acquired, res.path)
+		if !res.loaded {
+			queued = append(queued, res)
+		}
+	}
+	r.total += len(queued)
+	r.pending += len(queued)
+
+	go func() {
+		for _, res := range queued {
+			value, err := r.read(res.path, res.loader)
+			r.results <- resource_result{path: res.path, value: value, err: err}
+		}
+	}()
+
+	return func() {
+		for _, file_path := range acquired {
+			r.Release(file_path)
+		}
+	}
+}
+
+// Collects the resources that finished loading in the background.
+func (r *ResourceManager) Update() {
+	for r.pending > 0 {
+		select {
+		case result := <-r.results:
+			r.collect(result)
+		default:
+			return
+		}
+	}
+}
+
+func (r *ResourceManager) collect(result resource_result) {
+	r.pending--
+	r.done++
+	// released or loaded synchronously while in flight
+	if res, ok := r.resources[result.path]; ok && !res.loaded {
+		r.store(res, result.value, result.err)
+	}
+}
+
+// Blocks until everything preloaded so far is in.
+func (r *ResourceManager) Wait() {
+	for r.pending > 0 {
+		r.collect(<-r.results)
+	}
+}
+
+func (r *ResourceManager) Loading() bool {
+	return r.pending > 0
+}
+
+// From 0 to 1, over everything that was ever preloaded.
+func (r *ResourceManager) Progress() float64 {
+	if r.total == 0 {
+		return 1
+	}
+	return float64(r.done) / float64(r.total)
+}
+
+// Loads a file again, in place when its loader supports it so everything
+// already holding the resource sees the change.
+func (r *ResourceManager) Reload(file_path string) error {
+	res, ok := r.resources[path.Clean(file_path)]
+	if !ok {
+		return fmt.Errorf("%s: not loaded", file_path)
+	}
+	value, err := r.read(res.path, res.loader)
+	if err != nil {
+		return err
+	}
+	if res.loader.replace != nil && res.err == nil {
+		value, err = res.loader.replace(res.value, value)
+		if err != nil {
+			return err
+		}
+		res.value = value
+		return nil
+	}
+	r.store(res, value, nil)
+	return nil
+}
+
+func (r *ResourceManager) Loaded(file_path string) bool {
+	res, ok := r.resources[path.Clean(file_path)]
+	return ok && res.loaded
+}
+
+// Every loaded resource that is a placeholder, with the reason.
+func (r *ResourceManager) Fallbacks() LoadErrors {
+	errs := LoadErrors{}
+	for _, res := range r.resources {
+		if res.loaded && res.err != nil {
+			errs = append(errs, &LoadError{res.path, res.err})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].path < errs[j].path
+	})
+	return errs
+}
+
+// Returns the resource at file_path, which has to be loaded already. Missing
+// resources or resources of another type give the zero value.
+func GetResource[T any](r *ResourceManager, file_path string) T {
+	var zero T
+	res, ok := r.resources[path.Clean(file_path)]
+	if !ok || !res.loaded {
+		return zero
+	}
+	value, ok := res.value.(T)
+	if !ok {
+		return zero
+	}
+	return value
+}
+
+// A face of the font at file_path, falling back to a fixed size bitmap font.
+func (r *ResourceManager) Face(file_path string, size float64) text.Face {
+	source := GetResource[*text.GoTextFaceSource](r, file_path)
+	if source == nil {
+		return text.NewGoXFace(basicfont.Face7x13)
+	}
+	return &text.GoTextFace{Source: source, Size: size}
+}
+
+var ImageLoader = &ResourceLoader{
+	name:       "image",
+	extensions: []string{".png", ".jpg", ".jpeg"},
+	decode: func(data []byte) (any, error) {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		return img, err
+	},
+	finalize: func(value any) (any, error) {
+		return ebiten.NewImageFromImage(value.(image.Image)), nil
+	},
+	replace: func(old any, value any) (any, error) {
+		tex := old.(*ebiten.Image)
+		img := value.(image.Image)
+		size := img.Bounds().Size()
+		if tex.Bounds().Size() != size {
+			return nil, fmt.Errorf("size changed from %v to %v, restart to apply", tex.Bounds().Size(), size)
+		}
+		rgba := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		tex.WritePixels(rgba.Pix)
+		return tex, nil
+	},
+	placeholder: func() any {
+		return NewCheckerboard(16, 4)
+	},
+}
+
+var AudioLoader = &ResourceLoader{
+	name:       "audio",
+	extensions: []string{".wav", ".ogg"},
+	decode: func(data []byte) (any, error) {
+		var stream io.Reader
+		var err error
+		if bytes.HasPrefix(data, []byte("OggS")) {
+			stream, err = vorbis.DecodeWithSampleRate(SampleRate, bytes.NewReader(data))
+		} else {
+			stream, err = wav.DecodeWithSampleRate(SampleRate, bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, err
+		}
+		pcm, err := io.ReadAll(stream)
+		if err != nil {
+			return nil, err
+		}
+		return &AudioClip{pcm: pcm}, nil
+	},
+	placeholder: func() any {
+		return &AudioClip{pcm: []byte{}}
+	},
+}
+
+var FontLoader = &ResourceLoader{
+	name:       "font",
+	extensions: []string{".ttf", ".otf"},
+	decode: func(data []byte) (any, error) {
+		return text.NewGoTextFaceSource(bytes.NewReader(data))
+	},
+	placeholder: func() any {
+		// Face falls back to the bitmap font
+		return (*text.GoTextFaceSource)(nil)
+	},
+}
+
+var DataLoader = &ResourceLoader{
+	name:       "data",
+	extensions: []string{".json"},
+	decode: func(data []byte) (any, error) {
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("invalid json")
+		}
+		return json.RawMessage(data), nil
+	},
+	placeholder: func() any {
+		return json.RawMessage("null")
+	},
+}
+
+// Kage shaders are compiled on the game thread. Broken ones come back as
+// nil, whatever uses them has to draw without.
+var ShaderLoader = &ResourceLoader{
+	name:       "shader",
+	extensions: []string{".kage"},
+	decode: func(data []byte) (any, error) {
+		return data, nil
+	},
+	finalize: func(value any) (any, error) {
+		return ebiten.NewShader(value.([]byte))
+	},
+	placeholder: func() any {
+		return (*ebiten.Shader)(nil)
+	},
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const FadeTicks = FPS / 4
+
+// Scene is one screen of the game. Only the scene on top of the stack is
+// updated, the ones below are paused but still drawn unless an opaque scene
+// covers them.
+type Scene interface {
+	Update(scenes *SceneManager) error
+	Draw(screen *ebiten.Image)
+	Opaque() bool
+}
+
+// SceneManager runs the scene stack as the ebiten.Game. Transitions fade
+// to black, swap the scenes and fade back in.
+type SceneManager struct {
+	stack         []Scene
+	resources     *ResourceManager
+	audio_manager *AudioManager
+	input         *InputMap
+	face          text.Face
+	theme         *UITheme
+	fade          int // ticks left in the current fade
+	fade_out      bool
+	pending       func() // swaps the scenes once faded out
+	quit          bool
+}
+
+func NewSceneManager(resources *ResourceManager, audio_manager *AudioManager, input *InputMap, first Scene) *SceneManager {
+	return &SceneManager{
+		stack:         []Scene{first},
+		resources:     resources,
+		audio_manager: audio_manager,
+		input:         input,
+		face:          resources.Face(HUDFont, HUDFontSize),
+		theme:         NewUITheme(nil, resources.Face(HUDFont, HUDFontSize)),
+	}
+}
+
+func (s *SceneManager) Top() Scene {
+	return s.stack[len(s.stack)-1]
+}
+
+// Overlays go on top right away, without a fade.
+func (s *SceneManager) Push(scene Scene) {
+	s.stack = append(s.stack, scene)
+}
+
+func (s *SceneManager) Pop() {
+	if len(s.stack) > 1 {
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+}
+
+// Fades out, runs swap and fades back in.
+func (s *SceneManager) Transition(swap func()) {
+	if s.fade_out {
+		return
+	}
+	s.fade_out = true
+	s.fade = FadeTicks
+	s.pending = swap
+}
+
+// Replaces the top scene.
+func (s *SceneManager) Replace(scene Scene) {
+	s.Transition(func() {
+		s.stack[len(s.stack)-1] = scene
+	})
+}
+
+// Drops the whole stack for the scene build makes. The scene is only built
+// once faded out, the old one keeps running until then.
+func (s *SceneManager) Reset(build func() Scene) {
+	s.Transition(func() {
+		s.stack = []Scene{build()}
+	})
+}
+
+func (s *SceneManager) Quit() {
+	s.quit = true
+}
+
+func (s *SceneManager) Update() error {
+	if s.quit {
+		return ebiten.Termination
+	}
+	s.resources.Update()
+	s.audio_manager.Update()
+	s.input.Update()
+
+	if s.fade > 0 {
+		s.fade--
+		if s.fade == 0 && s.fade_out {
+			s.pending()
+			s.pending = nil
+			s.fade_out = false
+			s.fade = FadeTicks
+		}
+		return nil
+	}
+	return s.Top().Update(s)
+}
+
+func (s *SceneManager) Draw(screen *ebiten.Image) {
+	buffer := viewport.Buffer()
+	bottom := 0
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i].Opaque() {
+			bottom = i
+			break
+		}
+	}
+	for _, scene := range s.stack[bottom:] {
+		scene.Draw(buffer)
+	}
+
+	if s.fade > 0 {
+		alpha := float64(s.fade) / FadeTicks
+		if s.fade_out {
+			alpha = 1 - alpha
+		}
+		DrawDim(buffer, alpha)
+	}
+	viewport.Present(screen)
+}
+
+// The screen is as large as the window in real pixels, the viewport fits
+// the logical resolution into it.
+func (s *SceneManager) Layout(outsideWidth int, outsideHeight int) (int, int) {
+	scale := ebiten.Monitor().DeviceScaleFactor()
+	width := int(float64(outsideWidth) * scale)
+	height := int(float64(outsideHeight) * scale)
+	viewport.Fit(width, height)
+	return width, height
+}
+
+// Darkens everything drawn so far, alpha 1 is black.
+func DrawDim(screen *ebiten.Image, alpha float64) {
+	sw := float32(screen.Bounds().Dx())
+	sh := float32(screen.Bounds().Dy())
+	vector.DrawFilledRect(screen, 0, 0, sw, sh, color.RGBA{0, 0, 0, uint8(alpha * 255)}, false)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+)
+
+const menu_width = 160
+
+func screenCenter(screen *ebiten.Image) (float64, float64) {
+	return float64(screen.Bounds().Dx()) / 2, float64(screen.Bounds().Dy()) / 2
+}
+
+// Starts a panel w wide, centered horizontally on the scene, at y below the
+// center.
+func beginCentered(ui *UI, y float64, w float64, title string) {
+	ui.BeginPanel(ScreenWidth/2-w/2, ScreenHeight/2+y, w, title)
+}
+
+type TitleScene struct {
+	scenes *SceneManager
+	ui     *UI
+}
+
+func NewTitleScene(scenes *SceneManager) *TitleScene {
+	t := &TitleScene{scenes: scenes, ui: NewUI(scenes.theme)}
+	// laid out once up front so the menu shows while fading in
+	t.ui.Frame(UIInput{}, t.gui)
+	return t
+}
+
+func (t *TitleScene) gui() {
+	beginCentered(t.ui, 0, menu_width, "")
+	if t.ui.Button("Start") {
+		t.scenes.Reset(func() Scene { return NewGameplayScene(t.scenes) })
+	}
+	if t.ui.Button("Settings") {
+		t.scenes.Push(NewSettingsScene(t.scenes))
+	}
+	if t.ui.Button("Quit") {
+		t.scenes.Quit()
+	}
+	t.ui.EndPanel()
+}
+
+func (t *TitleScene) Update(scenes *SceneManager) error {
+	t.ui.Frame(PollUIInput(viewport.Cursor()), t.gui)
+	return nil
+}
+
+func (t *TitleScene) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{50, 50, 55, 255})
+	cx, cy := screenCenter(screen)
+	DrawText(screen, "SURVIVE THE HORDE", t.scenes.face, cx, cy-60, text.AlignCenter, color.RGBA{255, 30, 150, 255})
+	t.ui.Draw(screen)
+}
+
+func (t *TitleScene) Opaque() bool {
+	return true
+}
+
+// GameplayScene runs the global game, starting a fresh one.
+type GameplayScene struct{}
+
+func NewGameplayScene(scenes *SceneManager) *GameplayScene {
+	game = NewGame(scenes.resources, scenes.audio_manager, scenes.input)
+	return &GameplayScene{}
+}
+
+func (s *GameplayScene) Update(scenes *SceneManager) error {
+	if scenes.input.JustPressed(ActionQuit) {
+		scenes.Quit()
+		return nil
+	}
+	if scenes.input.JustPressed(ActionPause) {
+		scenes.Push(NewPauseScene(scenes))
+		return nil
+	}
+
+	if err := game.Update(); err != nil {
+		return err
+	}
+
+	if game.player.health <= 0 {
+		scenes.Replace(NewGameOverScene(scenes, game))
+	} else if game.player.pending_levels > 0 {
+		scenes.Push(NewLevelUpScene(scenes, game.player))
+	}
+	return nil
+}
+
+func (s *GameplayScene) Draw(screen *ebiten.Image) {
+	game.Draw(screen)
+}
+
+func (s *GameplayScene) Opaque() bool {
+	return true
+}
+
+type PauseScene struct {
+	scenes *SceneManager
+	ui     *UI
+}
+
+func NewPauseScene(scenes *SceneManager) *PauseScene {
+	p := &PauseScene{scenes: scenes, ui: NewUI(scenes.theme)}
+	p.ui.Frame(UIInput{}, p.gui)
+	return p
+}
+
+func (p *PauseScene) gui() {
+	beginCentered(p.ui, -40, menu_width, "PAUSED")
+	if p.ui.Button("Resume") || p.ui.Back() {
+		p.scenes.Pop()
+	}
+	if p.ui.Button("Settings") {
+		p.scenes.Push(NewSettingsScene(p.scenes))
+	}
+	if p.ui.Button("Quit to title") {
+		p.scenes.Reset(func() Scene { return NewTitleScene(p.scenes) })
+	}
+	p.ui.EndPanel()
+}
+
+func (p *PauseScene) Update(scenes *SceneManager) error {
+	if scenes.input.JustPressed(ActionPause) {
+		scenes.Pop()
+		return nil
+	}
+	p.ui.Frame(PollUIInput(viewport.Cursor()), p.gui)
+	return nil
+}
+
+func (p *PauseScene) Draw(screen *ebiten.Image) {
+	DrawDim(screen, 0.6)
+	p.ui.Draw(screen)
+}
+
+func (p *PauseScene) Opaque() bool {
+	return false
+}
+
+const upgrade_card_width = 200
+
+// LevelUpScene offers the upgrades as cards side by side, left and right
+// pick between them.
+type LevelUpScene struct {
+	scenes  *SceneManager
+	player  *Player
+	choices []*Upgrade
+	ui      *UI
+}
+
+func NewLevelUpScene(scenes *SceneManager, player *Player) *LevelUpScene {
+	l := &LevelUpScene{scenes: scenes, player: player, choices: RandomUpgrades(3), ui: NewUI(scenes.theme)}
+	l.ui.Frame(UIInput{}, l.gui)
+	return l
+}
+
+func (l *LevelUpScene) gui() {
+	w := float64(len(l.choices)) * upgrade_card_width
+	beginCentered(l.ui, -60, w, fmt.Sprintf("LEVEL %d", l.player.lvl+1))
+	l.ui.Row(len(l.choices))
+	for _, upgrade := range l.choices {
+		if l.ui.Card(upgrade.name, upgrade.desc) {
+			l.player.TakeUpgrade(upgrade)
+			l.player.pending_levels--
+			l.scenes.Pop()
+		}
+	}
+	l.ui.EndPanel()
+}
+
+func (l *LevelUpScene) Update(scenes *SceneManager) error {
+	input := PollUIInput(viewport.Cursor())
+	input.up, input.down = input.up || input.left, input.down || input.right
+	l.ui.Frame(input, l.gui)
+	return nil
+}
+
+func (l *LevelUpScene) Draw(screen *ebiten.Image) {
+	DrawDim(screen, 0.5)
+	l.ui.Draw(screen)
+}
+
+func (l *LevelUpScene) Opaque() bool {
+	return false
+}
+
+// GameOverScene keeps the stats of the finished run.
+type GameOverScene struct {
+	scenes *SceneManager
+	stats  []string
+	ui     *UI
+}
+
+func NewGameOverScene(scenes *SceneManager, g *Game) *GameOverScene {
+	seconds := g.ticks / FPS
+	o := &GameOverScene{
+		scenes: scenes,
+		ui:     NewUI(scenes.theme),
+		stats: []string{
+			fmt.Sprintf("survived %02d:%02d", seconds/60, seconds%60),
+			fmt.Sprintf("kills %d", g.kills),
+			fmt.Sprintf("level %d", g.player.lvl+1),
+			fmt.Sprintf("wave %d", g.spawner.wave),
+		},
+	}
+	o.ui.Frame(UIInput{}, o.gui)
+	return o
+}
+
+func (o *GameOverScene) gui() {
+	beginCentered(o.ui, -100, menu_width, "")
+	o.ui.Label("GAME OVER", color.RGBA{200, 30, 60, 255}, text.AlignCenter)
+	for _, stat := range o.stats {
+		o.ui.Label(stat, color.White, text.AlignCenter)
+	}
+	o.ui.Label("", color.White, text.AlignCenter)
+	if o.ui.Button("Retry") {
+		o.scenes.Reset(func() Scene { return NewGameplayScene(o.scenes) })
+	}
+	if o.ui.Button("Title") {
+		o.scenes.Reset(func() Scene { return NewTitleScene(o.scenes) })
+	}
+	o.ui.EndPanel()
+}
+
+func (o *GameOverScene) Update(scenes *SceneManager) error {
+	o.ui.Frame(PollUIInput(viewport.Cursor()), o.gui)
+	return nil
+}
+
+func (o *GameOverScene) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{30, 10, 20, 255})
+	o.ui.Draw(screen)
+}
+
+func (o *GameOverScene) Opaque() bool {
+	return true
+}
+
+type SettingsScene struct {
+	scenes *SceneManager
+	ui     *UI
+}
+
+func NewSettingsScene(scenes *SceneManager) *SettingsScene {
+	s := &SettingsScene{scenes: scenes, ui: NewUI(scenes.theme)}
+	s.ui.Frame(UIInput{}, s.gui)
+	return s
+}
+
+func (s *SettingsScene) gui() {
+	a := s.scenes.audio_manager
+	changed := false
+	volume := func(name string, v *float64) {
+		if s.ui.Slider(fmt.Sprintf("%s volume %d%%", name, int(*v*100+0.5)), v, 0, 1, 0.1) {
+			changed = true
+		}
+	}
+
+	beginCentered(s.ui, -140, 2*menu_width, "SETTINGS")
+	volume("Master", &settings.MasterVolume)
+	volume("Music", &settings.MusicVolume)
+	volume("Effects", &settings.SFXVolume)
+	scale := float64(settings.PixelScale)
+	scale_label := fmt.Sprintf("Pixel scale up to %dx", settings.PixelScale)
+	if settings.PixelScale == 0 {
+		scale_label = "Pixel scale as large as fits"
+	}
+	if s.ui.Slider(scale_label, &scale, 0, MaxPixelScale, 1) {
+		settings.PixelScale = int(scale)
+	}
+	size := float64(settings.windowSize())
+	size_label := fmt.Sprintf("Window size %dx%d", settings.WindowWidth, settings.WindowHeight)
+	if s.ui.Slider(size_label, &size, 0, float64(len(window_sizes)-1), 1) {
+		settings.SetWindowSize(int(size))
+	}
+	changed = s.ui.Toggle("Fullscreen", &settings.Fullscreen) || changed
+	changed = s.ui.Toggle("VSync", &settings.VSync) || changed
+	s.ui.Toggle("Hit-stop", &settings.HitStop)
+	s.ui.Toggle("Lighting", &settings.Lighting)
+	s.ui.Toggle("Debug view on start", &settings.Debug)
+	if changed {
+		settings.Apply(a)
+	}
+	if s.ui.Button("Controls") {
+		s.scenes.Push(NewControlsScene(s.scenes))
+	}
+	if s.ui.Button("Back") || s.ui.Back() {
+		if err := settings.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "saving the settings failed:", err)
+		}
+		s.scenes.Pop()
+	}
+	s.ui.EndPanel()
+}
+
+func (s *SettingsScene) Update(scenes *SceneManager) error {
+	s.ui.Frame(PollUIInput(viewport.Cursor()), s.gui)
+	return nil
+}
+
+func (s *SettingsScene) Draw(screen *ebiten.Image) {
+	DrawDim(screen, 0.8)
+	s.ui.Draw(screen)
+}
+
+func (s *SettingsScene) Opaque() bool {
+	return false
+}
+
+// ControlsScene rebinds the actions. Picking one waits for the next key,
+// button or stick direction and adds it to the actions bindings, backspace
+// clears them instead and escape cancels.
+type ControlsScene struct {
+	scenes    *SceneManager
+	ui        *UI
+	waiting   Action
+	capturing bool
+}
+
+func NewControlsScene(scenes *SceneManager) *ControlsScene {
+	c := &ControlsScene{scenes: scenes, ui: NewUI(scenes.theme)}
+	c.ui.Frame(UIInput{}, c.gui)
+	return c
+}
+
+func (c *ControlsScene) gui() {
+	input := c.scenes.input
+	beginCentered(c.ui, -160, 3*menu_width, "CONTROLS")
+	for a := Action(0); a < action_count; a++ {
+		bindings := []string{}
+		for _, binding := range input.Bindings(a) {
+			bindings = append(bindings, binding.Label())
+		}
+		label := a.Label() + ": " + strings.Join(bindings, ", ")
+		if c.capturing && c.waiting == a {
+			label = a.Label() + ": press a key or button"
+		}
+		if c.ui.Button(label) {
+			c.waiting = a
+			c.capturing = true
+		}
+	}
+	if c.ui.Button("Reset to defaults") {
+		input.Reset()
+	}
+	if c.ui.Button("Back") || c.ui.Back() {
+		if err := input.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "saving the bindings failed:", err)
+		}
+		c.scenes.Pop()
+	}
+	c.ui.EndPanel()
+}
+
+func (c *ControlsScene) Update(scenes *SceneManager) error {
+	if c.capturing {
+		switch {
+		case inpututil.IsKeyJustPressed(ebiten.KeyBackspace):
+			scenes.input.Unbind(c.waiting)
+			c.capturing = false
+		case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+			c.capturing = false
+		default:
+			if binding, ok := scenes.input.Capture(); ok {
+				scenes.input.Bind(c.waiting, binding)
+				c.capturing = false
+			}
+		}
+		// shows the new bindings, without reacting to the input again
+		c.ui.Frame(UIInput{}, c.gui)
+		return nil
+	}
+	c.ui.Frame(PollUIInput(viewport.Cursor()), c.gui)
+	return nil
+}
+
+func (c *ControlsScene) Draw(screen *ebiten.Image) {
+	DrawDim(screen, 0.8)
+	c.ui.Draw(screen)
+}
+
+func (c *ControlsScene) Opaque() bool {
+	return false
+}
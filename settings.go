@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const ConfigDirName = "survive-the-horde"
+const SettingsFileName = "settings.json"
+const MaxPixelScale = 4
+
+// Settings are kept in the settings file in the user config dir. Flags
+// given on the command line win over the file.
+type Settings struct {
+	WindowWidth  int     `json:"window_width"`
+	WindowHeight int     `json:"window_height"`
+	Fullscreen   bool    `json:"fullscreen"`
+	VSync        bool    `json:"vsync"`
+	PixelScale   int     `json:"pixel_scale"` // upper limit of the whole scale factor, 0 for none
+	MasterVolume float64 `json:"master_volume"`
+	MusicVolume  float64 `json:"music_volume"`
+	SFXVolume    float64 `json:"sfx_volume"`
+	HitStop      bool    `json:"hit_stop"`
+	Debug        bool    `json:"debug"` // runs start with the debug view on
+	Lighting     bool    `json:"lighting"`
+
+	path string // where Save writes to, empty to not persist
+}
+
+var settings = DefaultSettings()
+
+func DefaultSettings() *Settings {
+	return &Settings{
+		WindowWidth:  1920,
+		WindowHeight: 1200,
+		VSync:        true,
+		MasterVolume: 1,
+		MusicVolume:  0.5,
+		SFXVolume:    1,
+		HitStop:      true,
+		Lighting:     true,
+	}
+}
+
+// The defaults overridden by the settings file at path.
+func LoadSettings(file_path string) (*Settings, error) {
+	s := DefaultSettings()
+	s.path = file_path
+	if err := loadJSONConfig(file_path, s); err != nil {
+		// a broken file can leave the settings half read
+		s = DefaultSettings()
+		s.path = file_path
+		return s, err
+	}
+	s.clamp()
+	return s, nil
+}
+
+func (s *Settings) Save() error {
+	return saveJSONConfig(s.path, s)
+}
+
+// Takes over the flags that were given on the command line.
+func (s *Settings) ApplyFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "width":
+			s.WindowWidth = *window_width
+		case "height":
+			s.WindowHeight = *window_height
+		case "fullscreen":
+			s.Fullscreen = *fullscreen
+		case "vsync":
+			s.VSync = *vsync
+		case "scale":
+			s.PixelScale = *pixel_scale
+		case "volume":
+			s.MasterVolume = *master_volume
+		case "music":
+			s.MusicVolume = *music_volume
+		case "sfx":
+			s.SFXVolume = *sfx_volume
+		case "hitstop":
+			s.HitStop = *hit_stop
+		case "debug":
+			s.Debug = *debug_mode
+		case "lighting":
+			s.Lighting = *lighting
+		}
+	})
+	s.clamp()
+}
+
+func (s *Settings) clamp() {
+	defaults := DefaultSettings()
+	if s.WindowWidth <= 0 || s.WindowHeight <= 0 {
+		s.WindowWidth, s.WindowHeight = defaults.WindowWidth, defaults.WindowHeight
+	}
+	if s.PixelScale < 0 {
+		s.PixelScale = 0
+	}
+	if s.PixelScale > MaxPixelScale {
+		s.PixelScale = MaxPixelScale
+	}
+	s.MasterVolume = clampVolume(s.MasterVolume)
+	s.MusicVolume = clampVolume(s.MusicVolume)
+	s.SFXVolume = clampVolume(s.SFXVolume)
+}
+
+// Pushes everything but the window size to ebiten and the audio manager,
+// the window size is only set on startup and when picked in the settings
+// to not undo the players resizing.
+func (s *Settings) Apply(audio_manager *AudioManager) {
+	ebiten.SetFullscreen(s.Fullscreen)
+	ebiten.SetVsyncEnabled(s.VSync)
+	audio_manager.SetMasterVolume(s.MasterVolume)
+	audio_manager.SetMusicVolume(s.MusicVolume)
+	audio_manager.SetSFXVolume(s.SFXVolume)
+}
+
+// The window sizes to pick from in the settings, whole and half multiples
+// of the screen size.
+var window_sizes = [][2]int{
+	{ScreenWidth, ScreenHeight},
+	{ScreenWidth * 3 / 2, ScreenHeight * 3 / 2},
+	{ScreenWidth * 2, ScreenHeight * 2},
+	{ScreenWidth * 3, ScreenHeight * 3},
+}
+
+// Index of the window size in window_sizes, the first one larger than it
+// when the window was resized to something else.
+func (s *Settings) windowSize() int {
+	for i, size := range window_sizes {
+		if s.WindowWidth <= size[0] && s.WindowHeight <= size[1] {
+			return i
+		}
+	}
+	return len(window_sizes) - 1
+}
+
+func (s *Settings) SetWindowSize(i int) {
+	s.WindowWidth, s.WindowHeight = window_sizes[i][0], window_sizes[i][1]
+	ebiten.SetWindowSize(s.WindowWidth, s.WindowHeight)
+}
+
+// Where the settings and bindings files are kept when no path is given.
+func ConfigPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ConfigDirName, name), nil
+}
+
+// Reads the config file at path into v. Without the file v is left as it is,
+// so it keeps its defaults, which are saved there later on.
+func loadJSONConfig(file_path string, v any) error {
+	data, err := os.ReadFile(file_path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &LoadError{file_path, err}
+	}
+	return nil
+}
+
+// Writes v to the config file at path, an empty path does not persist.
+func saveJSONConfig(file_path string, v any) error {
+	if file_path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file_path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file_path, data, 0o644)
+}
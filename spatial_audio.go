@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+const MaxVoices = 24
+const AudibleDistance = 900 // from the edge of the view, in pixels
+const max_pan = 0.8
+
+// panner scales the left and right channel of 16 bit stereo PCM. The gains
+// are set from the game thread while the audio thread reads.
+type panner struct {
+	src    io.ReadSeeker
+	offset int64
+	left   atomic.Uint64
+	right  atomic.Uint64
+}
+
+func newPanner(src io.ReadSeeker) *panner {
+	p := &panner{src: src}
+	p.SetPan(0)
+	return p
+}
+
+// From -1, left only, to 1, right only. The center keeps both at full gain.
+func (p *panner) SetPan(pan float64) {
+	p.left.Store(math.Float64bits(math.Min(1, 1-pan)))
+	p.right.Store(math.Float64bits(math.Min(1, 1+pan)))
+}
+
+func (p *panner) Read(buf []byte) (int, error) {
+	n, err := p.src.Read(buf)
+	gains := [2]float64{math.Float64frombits(p.left.Load()), math.Float64frombits(p.right.Load())}
+	for i := 0; i+1 < n; i++ {
+		at := p.offset + int64(i)
+		if at%2 != 0 {
+			continue
+		}
+		v := float64(int16(uint16(buf[i]) | uint16(buf[i+1])<<8))
+		s := int16(v * gains[(at/2)%2])
+		buf[i] = byte(s)
+		buf[i+1] = byte(uint16(s) >> 8)
+	}
+	p.offset += int64(n)
+	return n, err
+}
+
+func (p *panner) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.src.Seek(offset, whence)
+	if err == nil {
+		p.offset = pos
+	}
+	return pos, err
+}
+
+// Gain and pan of a sound at pos as heard from the listener rect. Sounds in
+// view are at full volume, outside it they fade out over AudibleDistance.
+func SpatialGain(listener Rect, pos Vector2) (float64, float64) {
+	center := listener.pos.Add(listener.extents.Scale(0.5))
+	dx := math.Max(0, math.Abs(pos.x-center.x)-listener.extents.x/2)
+	dy := math.Max(0, math.Abs(pos.y-center.y)-listener.extents.y/2)
+	outside := math.Hypot(dx, dy)
+	gain := math.Max(0, 1-outside/AudibleDistance)
+
+	pan := 0.0
+	if listener.extents.x > 0 {
+		pan = (pos.x - center.x) / (listener.extents.x / 2)
+	}
+	pan = math.Max(-1, math.Min(1, pan)) * max_pan
+	return gain, pan
+}
+
+// Positional sounds are heard from the camera of the current game. The
+// audio manager outlives the games, so it must not hold on to a camera.
+func (a *AudioManager) listener() (Rect, bool) {
+	if game == nil {
+		return Rect{}, false
+	}
+	return game.camera.rect, true
+}
+
+// Plays a sound effect coming from a point in the world, too far away
+// sounds are not played at all.
+func (a *AudioManager) PlayAt(sound string, pos Vector2) *Voice {
+	listener, ok := a.listener()
+	if !ok {
+		return a.Play(sound)
+	}
+	gain, pan := SpatialGain(listener, pos)
+	if gain <= 0 {
+		return nil
+	}
+	voice := a.play(sound, gain, pan)
+	if voice != nil {
+		voice.positional = true
+		voice.pos = pos
+	}
+	return voice
+}
+
+// Makes room for a voice of the given priority, by cutting off the oldest
+// voice of the lowest priority. Returns false if everything playing matters
+// more.
+func (a *AudioManager) claimVoice(priority int) bool {
+	if len(a.voices) < MaxVoices {
+		return true
+	}
+	lowest := -1
+	for i, voice := range a.voices {
+		if lowest < 0 || voice.priority < a.voices[lowest].priority {
+			lowest = i
+		}
+	}
+	if a.voices[lowest].priority > priority {
+		return false
+	}
+	a.voices[lowest].Stop()
+	a.voices = append(a.voices[:lowest], a.voices[lowest+1:]...)
+	return true
+}
+
+// Follows the listener for positional voices that are still playing.
+func (a *AudioManager) updateSpatial() {
+	listener, ok := a.listener()
+	if !ok {
+		return
+	}
+	for _, voice := range a.voices {
+		if !voice.positional {
+			continue
+		}
+		voice.gain, voice.pan = SpatialGain(listener, voice.pos)
+		if voice.player != nil {
+			voice.player.SetVolume(a.sfxVolume(voice))
+			voice.panner.SetPan(voice.pan)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+type SpawnEvent struct {
+	at      int // tick at which the event fires
+	spawn   func(g *Game)
+	planned bool // part of the wave schedule, replaced when it is reloaded
+}
+
+// Spawner fires scheduled events as the game clock advances.
+type Spawner struct {
+	tick   int
+	wave   int
+	events []SpawnEvent
+}
+
+func NewSpawner() *Spawner {
+	return &Spawner{
+		tick:   0,
+		wave:   0,
+		events: []SpawnEvent{},
+	}
+}
+
+func (s *Spawner) Schedule(at int, spawn func(g *Game)) {
+	s.add(SpawnEvent{at: at, spawn: spawn})
+}
+
+// Schedules an event of the wave schedule.
+func (s *Spawner) Plan(at int, spawn func(g *Game)) {
+	s.add(SpawnEvent{at: at, spawn: spawn, planned: true})
+}
+
+func (s *Spawner) add(event SpawnEvent) {
+	s.events = append(s.events, event)
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].at < s.events[j].at
+	})
+}
+
+// Drops the planned events that did not fire yet, retries and the like
+// stay.
+func (s *Spawner) ClearPlanned() {
+	events := []SpawnEvent{}
+	for _, event := range s.events {
+		if !event.planned {
+			events = append(events, event)
+		}
+	}
+	s.events = events
+}
+
+func (s *Spawner) Update(g *Game) {
+	s.tick++
+	for len(s.events) > 0 && s.events[0].at <= s.tick {
+		event := s.events[0]
+		s.events = s.events[1:]
+		event.spawn(g)
+	}
+}
+
+// the boss tries again after this long when there is no room for it
+const BossSpawnRetryTicks = FPS
+
+// Picks a walkable position between min_r and max_r around center, used to
+// spawn things just outside of the view. Reports false when no free spot was
+// found, like when center is boxed in by walls.
+func RandomSpawnPoint(g *Game, center Vector2, min_r float64, max_r float64, size float64) (Vector2, bool) {
+	for i := 0; i < 32; i++ {
+		angle := rand.Float64() * 2 * math.Pi
+		r := min_r + rand.Float64()*(max_r-min_r)
+		pos := center.Add(Vector2{math.Cos(angle), math.Sin(angle)}.Scale(r))
+		if !g.world.Collides(NewRect(pos, Vector2{size, size})) {
+			return pos, true
+		}
+	}
+	return Vector2{}, false
+}
+
+// Enemies without a free spot are left out of the wave.
+func SpawnWave(count int, archetypes []*EnemyArchetype) func(g *Game) {
+	return func(g *Game) {
+		g.spawner.wave++
+		for i := 0; i < count; i++ {
+			pos, ok := RandomSpawnPoint(g, g.player.rect.pos, 600, 900, EnemySize)
+			if !ok {
+				continue
+			}
+			g.enemies = append(g.enemies, NewEnemy(pos, archetypes[rand.Intn(len(archetypes))], g.texture_manager))
+		}
+	}
+}
+
+func SpawnBoss() func(g *Game) {
+	return func(g *Game) {
+		if g.boss != nil {
+			return
+		}
+		pos, ok := RandomSpawnPoint(g, g.player.rect.pos, 400, 500, BossSize)
+		if !ok {
+			g.spawner.Schedule(g.spawner.tick+BossSpawnRetryTicks, SpawnBoss())
+			return
+		}
+		g.spawner.wave++
+		g.boss = NewBoss(pos, g.texture_manager)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// only json files named like this are loaded as sheet manifests, so other
+// json files can sit next to the textures
+const SheetManifestSuffix = "_sheet.json"
+
+type SheetFrame struct {
+	name     string
+	image    *ebiten.Image
+	duration int // milliseconds
+}
+
+type SheetTag struct {
+	name      string
+	from      int
+	to        int
+	direction string
+}
+
+// SpriteSheet is one texture holding many frames, described by a manifest
+// in the JSON format exported by Aseprite or TexturePacker.
+type SpriteSheet struct {
+	image  *ebiten.Image
+	frames []SheetFrame
+	names  map[string]int
+	tags   map[string]SheetTag
+}
+
+type sheet_rect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type sheet_frame struct {
+	Filename string     `json:"filename"`
+	Frame    sheet_rect `json:"frame"`
+	Duration int        `json:"duration"`
+}
+
+type sheet_manifest struct {
+	Frames json.RawMessage `json:"frames"`
+	Meta   struct {
+		Image     string `json:"image"`
+		FrameTags []struct {
+			Name      string `json:"name"`
+			From      int    `json:"from"`
+			To        int    `json:"to"`
+			Direction string `json:"direction"`
+		} `json:"frameTags"`
+	} `json:"meta"`
+}
+
+func parseSheetManifest(data []byte) (*sheet_manifest, []sheet_frame, error) {
+	manifest := &sheet_manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, nil, err
+	}
+
+	// frames are either an array or a hash keyed by the frame name
+	frames := []sheet_frame{}
+	if err := json.Unmarshal(manifest.Frames, &frames); err == nil {
+		return manifest, frames, nil
+	}
+
+	// walk the hash by hand, a map would lose the frame order
+	dec := json.NewDecoder(bytes.NewReader(manifest.Frames))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("sprite sheet frames are neither an array nor a hash")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		frame := sheet_frame{}
+		if err := dec.Decode(&frame); err != nil {
+			return nil, nil, err
+		}
+		frame.Filename = tok.(string)
+		frames = append(frames, frame)
+	}
+	return manifest, frames, nil
+}
+
+func NewSpriteSheet(img *ebiten.Image, manifest *sheet_manifest, frames []sheet_frame) (*SpriteSheet, error) {
+	s := &SpriteSheet{
+		image:  img,
+		frames: make([]SheetFrame, 0, len(frames)),
+		names:  map[string]int{},
+		tags:   map[string]SheetTag{},
+	}
+
+	for i, f := range frames {
+		r := image.Rect(f.Frame.X, f.Frame.Y, f.Frame.X+f.Frame.W, f.Frame.Y+f.Frame.H)
+		if !r.In(img.Bounds()) {
+			return nil, fmt.Errorf("sprite sheet frame %q out of bounds", f.Filename)
+		}
+		s.frames = append(s.frames, SheetFrame{
+			name:     f.Filename,
+			image:    img.SubImage(r).(*ebiten.Image),
+			duration: f.Duration,
+		})
+		s.names[f.Filename] = i
+	}
+
+	for _, t := range manifest.Meta.FrameTags {
+		if t.From < 0 || t.To >= len(s.frames) || t.From > t.To {
+			return nil, fmt.Errorf("sprite sheet tag %q out of range", t.Name)
+		}
+		s.tags[t.Name] = SheetTag{name: t.Name, from: t.From, to: t.To, direction: t.Direction}
+	}
+
+	return s, nil
+}
+
+func (s *SpriteSheet) Len() int {
+	return len(s.frames)
+}
+
+func (s *SpriteSheet) Frame(index int) *ebiten.Image {
+	return s.frames[index].image
+}
+
+func (s *SpriteSheet) FrameByName(name string) (*ebiten.Image, bool) {
+	i, ok := s.names[name]
+	if !ok {
+		return nil, false
+	}
+	return s.frames[i].image, true
+}
+
+// Builds an animation from a tag, keeping the duration of every frame and
+// mapping the tag direction to a playback mode.
+func (s *SpriteSheet) Animation(tag string) (*Animation, bool) {
+	t, ok := s.tags[tag]
+	if !ok {
+		return nil, false
+	}
+
+	frames := s.frames[t.from : t.to+1]
+	keyframes := make([]*ebiten.Image, len(frames))
+	durations := make([]int, len(frames))
+	for i, f := range frames {
+		keyframes[i] = f.image
+		durations[i] = MillisToTicks(f.duration)
+	}
+
+	mode := PlaybackLoop
+	switch t.direction {
+	case "reverse":
+		mode = PlaybackReverse
+	case "pingpong_reverse":
+		// ping-pong starting from the last frame is ping-pong over the reversed frames
+		for i, j := 0, len(keyframes)-1; i < j; i, j = i+1, j-1 {
+			keyframes[i], keyframes[j] = keyframes[j], keyframes[i]
+			durations[i], durations[j] = durations[j], durations[i]
+		}
+		mode = PlaybackPingPong
+	case "pingpong":
+		mode = PlaybackPingPong
+	}
+
+	return NewTimedAnimation(keyframes, durations).SetMode(mode), true
+}
+
+func MillisToTicks(ms int) int {
+	ticks := ms * FPS / 1000
+	if ticks < 1 {
+		return 1
+	}
+	return ticks
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+type SteeringWeights struct {
+	seek       float64
+	flee       float64
+	arrive     float64
+	wander     float64
+	separation float64
+	alignment  float64
+	cohesion   float64
+	avoidance  float64
+}
+
+// EnemyArchetype describes how a kind of enemy moves. The weights decide
+// how much every steering behaviour contributes to the final velocity.
+type EnemyArchetype struct {
+	name              string
+	max_speed         float64
+	max_accel         float64
+	weights           SteeringWeights
+	flee_radius       float64
+	arrive_radius     float64
+	separation_radius float64
+	neighbour_radius  float64
+	wander_radius     float64
+	wander_distance   float64
+	wander_jitter     float64
+	avoid_distance    float64
+	aggro_radius      float64
+	memory            int
+	attack_range      float64
+	attack_windup     int
+	attack_recovery   int
+}
+
+var GruntArchetype = &EnemyArchetype{
+	name:      "grunt",
+	max_speed: 0.33,
+	max_accel: 0.02,
+	weights: SteeringWeights{
+		seek:       1.0,
+		arrive:     0.5,
+		wander:     0.15,
+		separation: 1.6,
+		alignment:  0.2,
+		cohesion:   0.1,
+		avoidance:  2.0,
+	},
+	arrive_radius:     48,
+	separation_radius: EnemySize * 1.1,
+	neighbour_radius:  EnemySize * 2,
+	wander_radius:     1,
+	wander_distance:   2,
+	wander_jitter:     0.3,
+	avoid_distance:    EnemySize,
+	aggro_radius:      320,
+	memory:            3 * FPS,
+	attack_range:      EnemySize * 1.1,
+	attack_windup:     0.5 * FPS,
+	attack_recovery:   0.75 * FPS,
+}
+
+var SwarmerArchetype = &EnemyArchetype{
+	name:      "swarmer",
+	max_speed: 0.5,
+	max_accel: 0.04,
+	weights: SteeringWeights{
+		seek:       1.0,
+		wander:     0.4,
+		separation: 1.2,
+		alignment:  0.8,
+		cohesion:   0.6,
+		avoidance:  2.0,
+	},
+	separation_radius: EnemySize,
+	neighbour_radius:  EnemySize * 3,
+	wander_radius:     1,
+	wander_distance:   1.5,
+	wander_jitter:     0.6,
+	avoid_distance:    EnemySize,
+	aggro_radius:      400,
+	memory:            5 * FPS,
+	attack_range:      EnemySize,
+	attack_windup:     0.25 * FPS,
+	attack_recovery:   0.5 * FPS,
+}
+
+// Hits and runs, backing off from the player after every attack.
+var SkirmisherArchetype = &EnemyArchetype{
+	name:      "skirmisher",
+	max_speed: 0.45,
+	max_accel: 0.03,
+	weights: SteeringWeights{
+		seek:       0.8,
+		flee:       2.0,
+		wander:     0.3,
+		separation: 1.4,
+		avoidance:  2.0,
+	},
+	flee_radius:       96,
+	separation_radius: EnemySize * 1.2,
+	neighbour_radius:  EnemySize * 2,
+	wander_radius:     1,
+	wander_distance:   2,
+	wander_jitter:     0.5,
+	avoid_distance:    EnemySize * 1.5,
+	aggro_radius:      480,
+	memory:            2 * FPS,
+	attack_range:      EnemySize * 1.3,
+	attack_windup:     0.4 * FPS,
+	attack_recovery:   FPS,
+}
+
+func Seek(pos Vector2, vel Vector2, target Vector2, max_speed float64) Vector2 {
+	diff := target.Sub(pos)
+	if diff.IsZero() {
+		return Vector2{0, 0}
+	}
+	return diff.Norm().Scale(max_speed).Sub(vel)
+}
+
+// Flee only pushes away while the threat is inside radius.
+func Flee(pos Vector2, vel Vector2, threat Vector2, max_speed float64, radius float64) Vector2 {
+	diff := pos.Sub(threat)
+	dist := diff.Mag()
+	if dist == 0 || dist > radius {
+		return Vector2{0, 0}
+	}
+	return diff.Norm().Scale(max_speed).Sub(vel)
+}
+
+// Like seek, but slows down inside radius to come to rest on target.
+func Arrive(pos Vector2, vel Vector2, target Vector2, max_speed float64, radius float64) Vector2 {
+	diff := target.Sub(pos)
+	dist := diff.Mag()
+	if dist == 0 {
+		return vel.Scale(-1)
+	}
+	speed := max_speed
+	if dist < radius {
+		speed = max_speed * dist / radius
+	}
+	return diff.Norm().Scale(speed).Sub(vel)
+}
+
+// Heads for a point on a circle in front of the agent, jittering the point
+// a little every call. The angle is kept by the caller between calls.
+func Wander(vel Vector2, angle *float64, radius float64, distance float64, jitter float64) Vector2 {
+	*angle += (rand.Float64() - 0.5) * 2 * jitter
+
+	heading := Vector2{1, 0}
+	if !vel.IsZero() {
+		heading = vel.Norm()
+	}
+	circle := heading.Scale(distance)
+	offset := Vector2{math.Cos(*angle), math.Sin(*angle)}.Scale(radius)
+	desired := circle.Add(offset)
+	if desired.IsZero() {
+		return Vector2{0, 0}
+	}
+	return desired.Norm()
+}
+
+func Separation(pos Vector2, neighbours []Vector2, radius float64) Vector2 {
+	force := Vector2{0, 0}
+	for _, n := range neighbours {
+		diff := pos.Sub(n)
+		dist := diff.Mag()
+		if dist == 0 || dist > radius {
+			continue
+		}
+		// the closer the neighbour the stronger the push
+		force.AddEq(diff.Norm().Scale((radius - dist) / radius))
+	}
+	return force
+}
+
+func Alignment(vel Vector2, neighbour_vels []Vector2) Vector2 {
+	if len(neighbour_vels) == 0 {
+		return Vector2{0, 0}
+	}
+	avg := Vector2{0, 0}
+	for _, v := range neighbour_vels {
+		avg.AddEq(v)
+	}
+	return avg.Scale(1 / float64(len(neighbour_vels))).Sub(vel)
+}
+
+func Cohesion(pos Vector2, vel Vector2, neighbours []Vector2, max_speed float64) Vector2 {
+	if len(neighbours) == 0 {
+		return Vector2{0, 0}
+	}
+	center := Vector2{0, 0}
+	for _, n := range neighbours {
+		center.AddEq(n)
+	}
+	return Seek(pos, vel, center.Scale(1/float64(len(neighbours))), max_speed)
+}
+
+// Probes the world ahead of the agent and steers away from the first solid
+// tile found, proportionally to how close it is.
+func ObstacleAvoidance(pos Vector2, vel Vector2, world *World, distance float64) Vector2 {
+	if vel.IsZero() {
+		return Vector2{0, 0}
+	}
+	heading := vel.Norm()
+
+	for _, angle := range [3]float64{0, math.Pi / 6, -math.Pi / 6} {
+		probe := pos.Add(heading.Rotate(angle).Scale(distance))
+		x, y := world.PosToCell(probe)
+		if !world.Solid(x, y) {
+			continue
+		}
+		away := pos.Sub(world.CellCenter(x, y))
+		if away.IsZero() {
+			return Vector2{0, 0}
+		}
+		strength := 1 - math.Min(away.Mag()/(distance+TileSize), 1)
+		return away.Norm().Scale(strength)
+	}
+	return Vector2{0, 0}
+}
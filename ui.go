@@ -0,0 +1,475 @@
+package main
+
+import (
+	"image/color"
+	"io/fs"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// UIInput is everything the UI reacts to during one tick. PollUIInput fills
+// it from the keyboard, the mouse at the given position and gamepads, but it
+// can be built by hand to drive the UI without a window.
+type UIInput struct {
+	mouse         Vector2
+	mouse_moved   bool
+	mouse_down    bool
+	mouse_pressed bool
+	up            bool
+	down          bool
+	left          bool
+	right         bool
+	activate      bool
+	back          bool
+	from_letters  bool // the navigation came from WASD, not arrows or a pad
+	chars         []rune
+	backspace     bool
+}
+
+var last_cursor Vector2
+
+func PollUIInput(mouse Vector2) UIInput {
+	in := UIInput{
+		mouse:         mouse,
+		mouse_moved:   mouse != last_cursor,
+		mouse_down:    ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft),
+		mouse_pressed: inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft),
+		up:            inpututil.IsKeyJustPressed(ebiten.KeyArrowUp),
+		down:          inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) || inpututil.IsKeyJustPressed(ebiten.KeyTab),
+		left:          inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft),
+		right:         inpututil.IsKeyJustPressed(ebiten.KeyArrowRight),
+		activate:      inpututil.IsKeyJustPressed(ebiten.KeyEnter),
+		back:          inpututil.IsKeyJustPressed(ebiten.KeyEscape),
+		chars:         ebiten.AppendInputChars(nil),
+		backspace:     inpututil.IsKeyJustPressed(ebiten.KeyBackspace),
+	}
+	last_cursor = mouse
+
+	letters := false
+	pressed := func(key ebiten.Key) bool {
+		if inpututil.IsKeyJustPressed(key) {
+			letters = true
+			return true
+		}
+		return false
+	}
+	in.up = pressed(ebiten.KeyW) || in.up
+	in.down = pressed(ebiten.KeyS) || in.down
+	in.left = pressed(ebiten.KeyA) || in.left
+	in.right = pressed(ebiten.KeyD) || in.right
+	in.from_letters = letters
+	in.activate = in.activate || inpututil.IsKeyJustPressed(ebiten.KeySpace)
+
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		pad := func(b ebiten.StandardGamepadButton) bool {
+			return inpututil.IsStandardGamepadButtonJustPressed(id, b)
+		}
+		in.up = in.up || pad(ebiten.StandardGamepadButtonLeftTop)
+		in.down = in.down || pad(ebiten.StandardGamepadButtonLeftBottom)
+		in.left = in.left || pad(ebiten.StandardGamepadButtonLeftLeft)
+		in.right = in.right || pad(ebiten.StandardGamepadButtonLeftRight)
+		in.activate = in.activate || pad(ebiten.StandardGamepadButtonRightBottom)
+		in.back = in.back || pad(ebiten.StandardGamepadButtonRightRight)
+	}
+	return in
+}
+
+// UITheme holds the look of the UI. Textures are optional, widgets without
+// one are drawn as flat rectangles.
+type UITheme struct {
+	face         text.Face
+	panel        *ebiten.Image
+	button       *ebiten.Image
+	button_focus *ebiten.Image
+	text         color.Color
+	text_dim     color.Color
+	accent       color.Color
+	fill         color.Color
+	fill_focus   color.Color
+	padding      float64
+	spacing      float64
+}
+
+// Picks up the ui_panel, ui_button and ui_button_focus textures when the
+// resources have them.
+func NewUITheme(tm *TextureManager, face text.Face) *UITheme {
+	theme := &UITheme{
+		face:       face,
+		text:       color.White,
+		text_dim:   color.RGBA{160, 160, 170, 255},
+		accent:     color.RGBA{255, 220, 60, 255},
+		fill:       color.RGBA{30, 30, 40, 220},
+		fill_focus: color.RGBA{90, 40, 80, 240},
+		padding:    6,
+		spacing:    4,
+	}
+	if tm != nil {
+		theme.panel, _ = tm.LookupTexture("ui_panel")
+		theme.button, _ = tm.LookupTexture("ui_button")
+		theme.button_focus, _ = tm.LookupTexture("ui_button_focus")
+	}
+	return theme
+}
+
+// Loads the theme textures the resources have into tm, the others are left
+// out instead of getting the unknown texture.
+func LoadUITextures(tm *TextureManager) error {
+	for _, key := range []string{"ui_panel", "ui_button", "ui_button_focus"} {
+		file_path := key + ".png"
+		if _, err := fs.Stat(tm.res.fsys, file_path); err != nil {
+			continue
+		}
+		if err := tm.LoadTexture(key, file_path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *UITheme) LineHeight() float64 {
+	m := t.face.Metrics()
+	return m.HAscent + m.HDescent
+}
+
+type ui_layout struct {
+	x, y, w   float64
+	columns   int // widgets per row, 1 stacks them
+	column    int
+	row_h     float64
+	start_y   float64
+	panel_idx int // index of the panel background command, -1 without one
+}
+
+// UI is an immediate mode toolkit: every tick the widgets are declared again
+// between Begin and End, each returning whether it was used. Drawing is
+// recorded while declaring and replayed by Draw.
+type UI struct {
+	theme   *UITheme
+	input   UIInput
+	layouts []*ui_layout
+	cmds    []func(screen *ebiten.Image)
+	count   int // focusable widgets declared this tick
+	focus   int
+	typing  bool // the focused widget takes text
+}
+
+func NewUI(theme *UITheme) *UI {
+	return &UI{theme: theme}
+}
+
+func (u *UI) Begin(input UIInput) {
+	u.input = input
+	if u.typing && input.from_letters {
+		u.input.up, u.input.down, u.input.left, u.input.right = false, false, false, false
+	}
+	u.cmds = u.cmds[:0]
+	u.layouts = u.layouts[:0]
+	u.count = 0
+	u.typing = false
+}
+
+// Moves the focus for the next tick, once the number of widgets is known.
+func (u *UI) End() {
+	if u.count == 0 {
+		return
+	}
+	if u.input.down {
+		u.focus++
+	}
+	if u.input.up {
+		u.focus--
+	}
+	u.focus = (u.focus%u.count + u.count) % u.count
+}
+
+// Declares the widgets in gui for one tick.
+func (u *UI) Frame(input UIInput, gui func()) {
+	u.Begin(input)
+	gui()
+	u.End()
+}
+
+func (u *UI) Back() bool {
+	return u.input.back
+}
+
+func (u *UI) SetFocus(index int) {
+	u.focus = index
+}
+
+func (u *UI) Focus() int {
+	return u.focus
+}
+
+// Starts a column of widgets at x, y that is w wide. With a title, the
+// column gets a panel behind it.
+func (u *UI) BeginPanel(x float64, y float64, w float64, title string) {
+	l := &ui_layout{x: x, y: y, w: w, columns: 1, start_y: y, panel_idx: -1}
+	if title != "" {
+		l.panel_idx = len(u.cmds)
+		u.cmds = append(u.cmds, nil)
+		l.y += u.theme.padding
+		l.x += u.theme.padding
+		l.w -= 2 * u.theme.padding
+		u.layouts = append(u.layouts, l)
+		u.Label(title, u.theme.accent, text.AlignCenter)
+		return
+	}
+	u.layouts = append(u.layouts, l)
+}
+
+func (u *UI) EndPanel() Rect {
+	l := u.layout()
+	u.endRow()
+	u.layouts = u.layouts[:len(u.layouts)-1]
+	r := NewRect(Vector2{l.x, l.start_y}, Vector2{l.w, l.y - l.start_y})
+	if l.panel_idx >= 0 {
+		r = NewRect(Vector2{l.x - u.theme.padding, l.start_y}, Vector2{l.w + 2*u.theme.padding, l.y - l.start_y + u.theme.padding})
+		u.cmds[l.panel_idx] = func(screen *ebiten.Image) {
+			u.drawBox(screen, r, u.theme.panel, u.theme.fill)
+		}
+	}
+	return r
+}
+
+// The next columns widgets go side by side.
+func (u *UI) Row(columns int) {
+	l := u.layout()
+	u.endRow()
+	l.columns = columns
+}
+
+func (u *UI) layout() *ui_layout {
+	if len(u.layouts) == 0 {
+		u.layouts = append(u.layouts, &ui_layout{w: 200, columns: 1, panel_idx: -1})
+	}
+	return u.layouts[len(u.layouts)-1]
+}
+
+func (u *UI) endRow() {
+	l := u.layout()
+	if l.column > 0 {
+		l.y += l.row_h + u.theme.spacing
+	}
+	l.column = 0
+	l.row_h = 0
+	l.columns = 1
+}
+
+// Reserves the space for the next widget.
+func (u *UI) next(h float64) Rect {
+	l := u.layout()
+	w := (l.w - u.theme.spacing*float64(l.columns-1)) / float64(l.columns)
+	r := NewRect(Vector2{l.x + float64(l.column)*(w+u.theme.spacing), l.y}, Vector2{w, h})
+	l.row_h = math.Max(l.row_h, h)
+	l.column++
+	if l.column >= l.columns {
+		l.y += l.row_h + u.theme.spacing
+		l.column = 0
+		l.row_h = 0
+	}
+	return r
+}
+
+// Registers a focusable widget, returns whether it has the focus and
+// whether the mouse is over it.
+func (u *UI) widget(r Rect) (bool, bool) {
+	id := u.count
+	u.count++
+	hovered := r.ContainsPoint(u.input.mouse)
+	if hovered && (u.input.mouse_moved || u.input.mouse_pressed) {
+		u.focus = id
+	}
+	return u.focus == id, hovered
+}
+
+func (u *UI) pressed(focused bool, hovered bool) bool {
+	return (focused && u.input.activate) || (hovered && u.input.mouse_pressed)
+}
+
+func (u *UI) Label(str string, clr color.Color, align text.Align) {
+	r := u.next(u.theme.LineHeight())
+	x := r.pos.x
+	switch align {
+	case text.AlignCenter:
+		x += r.extents.x / 2
+	case text.AlignEnd:
+		x += r.extents.x
+	}
+	u.cmds = append(u.cmds, func(screen *ebiten.Image) {
+		DrawText(screen, str, u.theme.face, x, r.pos.y, align, clr)
+	})
+}
+
+func (u *UI) Button(label string) bool {
+	r := u.next(u.theme.LineHeight() + 2*u.theme.padding)
+	focused, hovered := u.widget(r)
+	u.cmds = append(u.cmds, func(screen *ebiten.Image) {
+		u.drawButton(screen, r, focused)
+		DrawText(screen, label, u.theme.face, r.pos.x+r.extents.x/2, r.pos.y+u.theme.padding, text.AlignCenter, u.textColor(focused))
+	})
+	return u.pressed(focused, hovered)
+}
+
+// A tall button with a title and a line of description, for choices.
+func (u *UI) Card(title string, desc string) bool {
+	line := u.theme.LineHeight()
+	r := u.next(3*line + 2*u.theme.padding)
+	focused, hovered := u.widget(r)
+	u.cmds = append(u.cmds, func(screen *ebiten.Image) {
+		u.drawButton(screen, r, focused)
+		cx := r.pos.x + r.extents.x/2
+		DrawText(screen, title, u.theme.face, cx, r.pos.y+u.theme.padding, text.AlignCenter, u.theme.accent)
+		DrawText(screen, desc, u.theme.face, cx, r.pos.y+u.theme.padding+1.5*line, text.AlignCenter, u.textColor(focused))
+	})
+	return u.pressed(focused, hovered)
+}
+
+func (u *UI) Toggle(label string, value *bool) bool {
+	state := "off"
+	if *value {
+		state = "on"
+	}
+	if u.Button(label + ": " + state) {
+		*value = !*value
+		return true
+	}
+	return false
+}
+
+// Left and right move the value by step, the mouse drags it.
+func (u *UI) Slider(label string, value *float64, min float64, max float64, step float64) bool {
+	line := u.theme.LineHeight()
+	r := u.next(2*line + u.theme.padding)
+	focused, hovered := u.widget(r)
+	old := *value
+	if focused && u.input.left {
+		*value -= step
+	}
+	if focused && u.input.right {
+		*value += step
+	}
+	track := NewRect(Vector2{r.pos.x, r.pos.y + line + 2}, Vector2{r.extents.x, line - 4})
+	if hovered && u.input.mouse_down && track.extents.x > 0 && track.ContainsPoint(u.input.mouse) {
+		*value = min + (u.input.mouse.x-track.pos.x)/track.extents.x*(max-min)
+		if step > 0 {
+			*value = math.Round(*value/step) * step
+		}
+	}
+	*value = math.Max(min, math.Min(max, *value))
+
+	fill := 0.0
+	if max > min {
+		fill = (*value - min) / (max - min)
+	}
+	u.cmds = append(u.cmds, func(screen *ebiten.Image) {
+		DrawText(screen, label, u.theme.face, r.pos.x, r.pos.y, text.AlignStart, u.textColor(focused))
+		vector.DrawFilledRect(screen, float32(track.pos.x), float32(track.pos.y), float32(track.extents.x), float32(track.extents.y), u.theme.fill, false)
+		vector.DrawFilledRect(screen, float32(track.pos.x), float32(track.pos.y), float32(track.extents.x*fill), float32(track.extents.y), u.fillColor(focused), false)
+	})
+	return *value != old
+}
+
+// One focusable row per item, picking one sets selected.
+func (u *UI) List(items []string, selected *int) bool {
+	changed := false
+	for i, item := range items {
+		r := u.next(u.theme.LineHeight() + u.theme.padding)
+		focused, hovered := u.widget(r)
+		if u.pressed(focused, hovered) && *selected != i {
+			*selected = i
+			changed = true
+		}
+		current := *selected == i
+		label := item
+		u.cmds = append(u.cmds, func(screen *ebiten.Image) {
+			if focused {
+				vector.DrawFilledRect(screen, float32(r.pos.x), float32(r.pos.y), float32(r.extents.x), float32(r.extents.y), u.theme.fill_focus, false)
+			}
+			clr := u.textColor(focused)
+			if current {
+				clr = u.theme.accent
+			}
+			DrawText(screen, label, u.theme.face, r.pos.x+u.theme.padding, r.pos.y+u.theme.padding/2, text.AlignStart, clr)
+		})
+	}
+	return changed
+}
+
+// Takes typed characters while focused, up to max runes.
+func (u *UI) TextInput(value *string, max int) bool {
+	r := u.next(u.theme.LineHeight() + 2*u.theme.padding)
+	focused, _ := u.widget(r)
+	old := *value
+	if focused {
+		u.typing = true
+		runes := []rune(*value)
+		if u.input.backspace && len(runes) > 0 {
+			runes = runes[:len(runes)-1]
+		}
+		for _, c := range u.input.chars {
+			if len(runes) < max {
+				runes = append(runes, c)
+			}
+		}
+		*value = string(runes)
+	}
+	shown := *value
+	if focused {
+		shown += "_"
+	}
+	u.cmds = append(u.cmds, func(screen *ebiten.Image) {
+		vector.DrawFilledRect(screen, float32(r.pos.x), float32(r.pos.y), float32(r.extents.x), float32(r.extents.y), u.fillColor(focused), false)
+		DrawText(screen, shown, u.theme.face, r.pos.x+u.theme.padding, r.pos.y+u.theme.padding, text.AlignStart, u.theme.text)
+	})
+	return *value != old
+}
+
+func (u *UI) Draw(screen *ebiten.Image) {
+	for _, cmd := range u.cmds {
+		if cmd != nil {
+			cmd(screen)
+		}
+	}
+}
+
+func (u *UI) textColor(focused bool) color.Color {
+	if focused {
+		return u.theme.accent
+	}
+	return u.theme.text
+}
+
+func (u *UI) fillColor(focused bool) color.Color {
+	if focused {
+		return u.theme.fill_focus
+	}
+	return u.theme.fill
+}
+
+func (u *UI) drawButton(screen *ebiten.Image, r Rect, focused bool) {
+	img := u.theme.button
+	if focused && u.theme.button_focus != nil {
+		img = u.theme.button_focus
+	}
+	u.drawBox(screen, r, img, u.fillColor(focused))
+}
+
+// Stretches img over r, or fills r with clr without one.
+func (u *UI) drawBox(screen *ebiten.Image, r Rect, img *ebiten.Image, clr color.Color) {
+	if img == nil {
+		vector.DrawFilledRect(screen, float32(r.pos.x), float32(r.pos.y), float32(r.extents.x), float32(r.extents.y), clr, false)
+		return
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(r.extents.x/float64(img.Bounds().Dx()), r.extents.y/float64(img.Bounds().Dy()))
+	op.GeoM.Translate(r.pos.x, r.pos.y)
+	screen.DrawImage(img, op)
+}
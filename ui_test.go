@@ -0,0 +1,220 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"golang.org/x/image/font/basicfont"
+)
+
+func newTestUI() *UI {
+	return NewUI(NewUITheme(nil, text.NewGoXFace(basicfont.Face7x13)))
+}
+
+// Declares count buttons in a panel at x, y and returns which were pressed.
+func buttons(u *UI, x float64, y float64, count int) (func(), []bool) {
+	pressed := make([]bool, count)
+	return func() {
+		for i := range pressed {
+			pressed[i] = false
+		}
+		u.BeginPanel(x, y, 100, "")
+		for i := range pressed {
+			pressed[i] = u.Button("button")
+		}
+		u.EndPanel()
+	}, pressed
+}
+
+func TestUIFocusWraps(t *testing.T) {
+	u := newTestUI()
+	gui, _ := buttons(u, 0, 0, 3)
+
+	steps := []struct {
+		input UIInput
+		focus int
+	}{
+		{UIInput{up: true}, 2},
+		{UIInput{up: true}, 1},
+		{UIInput{down: true}, 2},
+		{UIInput{down: true}, 0},
+		{UIInput{}, 0},
+	}
+	for i, step := range steps {
+		u.Frame(step.input, gui)
+		if u.Focus() != step.focus {
+			t.Fatalf("step %d: focus = %d, want %d", i, u.Focus(), step.focus)
+		}
+	}
+}
+
+func TestUIActivate(t *testing.T) {
+	u := newTestUI()
+	gui, pressed := buttons(u, 0, 0, 3)
+
+	u.SetFocus(1)
+	u.Frame(UIInput{activate: true}, gui)
+	if pressed[0] || !pressed[1] || pressed[2] {
+		t.Errorf("enter pressed %v, want only the focused button", pressed)
+	}
+
+	u.Frame(UIInput{}, gui)
+	if pressed[0] || pressed[1] || pressed[2] {
+		t.Errorf("pressed %v without any input", pressed)
+	}
+}
+
+func TestUIClick(t *testing.T) {
+	u := newTestUI()
+	gui, pressed := buttons(u, 20, 10, 3)
+	h := u.theme.LineHeight() + 2*u.theme.padding
+	third := Vector2{70, 10 + 2*(h+u.theme.spacing) + h/2}
+
+	// hovering without moving the mouse keeps the focus where it is
+	u.Frame(UIInput{mouse: third}, gui)
+	if u.Focus() != 0 {
+		t.Errorf("focus = %d after a still mouse, want 0", u.Focus())
+	}
+
+	u.Frame(UIInput{mouse: third, mouse_down: true, mouse_pressed: true}, gui)
+	if pressed[0] || pressed[1] || !pressed[2] {
+		t.Errorf("click pressed %v, want the third button", pressed)
+	}
+	if u.Focus() != 2 {
+		t.Errorf("focus = %d after the click, want 2", u.Focus())
+	}
+
+	// in the spacing between two buttons
+	gap := Vector2{70, 10 + h + u.theme.spacing/2}
+	u.Frame(UIInput{mouse: gap, mouse_down: true, mouse_pressed: true}, gui)
+	if pressed[0] || pressed[1] || pressed[2] {
+		t.Errorf("click between buttons pressed %v", pressed)
+	}
+}
+
+func TestUISlider(t *testing.T) {
+	u := newTestUI()
+	value := 0.0
+	changed := false
+	gui := func() {
+		u.BeginPanel(0, 0, 100, "")
+		changed = u.Slider("volume", &value, 0, 1, 0.1)
+		u.EndPanel()
+	}
+	line := u.theme.LineHeight()
+	track_y := line + 2 + (line-4)/2
+
+	steps := []struct {
+		name  string
+		start float64
+		input UIInput
+		want  float64
+	}{
+		{"step right", 0.5, UIInput{right: true}, 0.6},
+		{"step left", 0.5, UIInput{left: true}, 0.4},
+		{"clamp max", 0.95, UIInput{right: true}, 1},
+		{"clamp min", 0.05, UIInput{left: true}, 0},
+		{"out of range", 3, UIInput{}, 1},
+		{"mouse rounds", 0, UIInput{mouse: Vector2{33, track_y}, mouse_down: true}, 0.3},
+		{"mouse rounds up", 0, UIInput{mouse: Vector2{37, track_y}, mouse_down: true}, 0.4},
+		{"mouse end", 0, UIInput{mouse: Vector2{99, track_y}, mouse_down: true}, 1},
+		{"mouse on label", 0.5, UIInput{mouse: Vector2{33, line / 2}, mouse_down: true}, 0.5},
+	}
+	for _, step := range steps {
+		value = step.start
+		u.Frame(step.input, gui)
+		if math.Abs(value-step.want) > 1e-9 {
+			t.Errorf("%s: value = %v, want %v", step.name, value, step.want)
+		}
+		if changed != (step.start != value) {
+			t.Errorf("%s: changed = %v", step.name, changed)
+		}
+	}
+}
+
+func TestUILayout(t *testing.T) {
+	u := newTestUI()
+	p, s := u.theme.padding, u.theme.spacing
+	line := u.theme.LineHeight()
+	button := line + 2*p
+
+	rects := []Rect{}
+	var panel Rect
+	u.Frame(UIInput{}, func() {
+		u.BeginPanel(10, 20, 200, "")
+		u.Row(3)
+		for i := 0; i < 3; i++ {
+			rects = append(rects, u.next(10))
+		}
+		u.Row(1)
+		rects = append(rects, u.next(30))
+		panel = u.EndPanel()
+	})
+
+	w := (200 - 2*s) / 3
+	want := []Rect{
+		NewRect(Vector2{10, 20}, Vector2{w, 10}),
+		NewRect(Vector2{10 + w + s, 20}, Vector2{w, 10}),
+		NewRect(Vector2{10 + 2*(w+s), 20}, Vector2{w, 10}),
+		NewRect(Vector2{10, 20 + 10 + s}, Vector2{200, 30}),
+	}
+	for i := range want {
+		if rects[i] != want[i] {
+			t.Errorf("widget %d at %v, want %v", i, rects[i], want[i])
+		}
+	}
+	if want := NewRect(Vector2{10, 20}, Vector2{200, 10 + s + 30 + s}); panel != want {
+		t.Errorf("panel at %v, want %v", panel, want)
+	}
+
+	// a title adds padding around the panel and a label on top
+	u.Frame(UIInput{}, func() {
+		u.BeginPanel(10, 20, 200, "title")
+		u.Button("button")
+		panel = u.EndPanel()
+	})
+	if want := NewRect(Vector2{10, 20}, Vector2{200, p + line + s + button + s + p}); panel != want {
+		t.Errorf("titled panel at %v, want %v", panel, want)
+	}
+}
+
+func TestUITextInputTakesLetters(t *testing.T) {
+	u := newTestUI()
+	value := ""
+	gui := func() {
+		u.BeginPanel(0, 0, 100, "")
+		u.TextInput(&value, 4)
+		u.Button("ok")
+		u.EndPanel()
+	}
+	u.Frame(UIInput{}, gui)
+
+	// typing an s must not move the focus down
+	u.Frame(UIInput{down: true, from_letters: true, chars: []rune{'s'}}, gui)
+	if u.Focus() != 0 || value != "s" {
+		t.Fatalf("focus = %d, value = %q, want 0 and \"s\"", u.Focus(), value)
+	}
+
+	u.Frame(UIInput{chars: []rune("word")}, gui)
+	if value != "swor" {
+		t.Errorf("value = %q, want it cut off at 4 runes", value)
+	}
+	u.Frame(UIInput{backspace: true}, gui)
+	if value != "swo" {
+		t.Errorf("value = %q after backspace, want \"swo\"", value)
+	}
+
+	// arrows still leave the text input
+	u.Frame(UIInput{down: true}, gui)
+	if u.Focus() != 1 {
+		t.Errorf("focus = %d after arrow down, want 1", u.Focus())
+	}
+
+	// and letters navigate once nothing takes text, from the next tick on
+	u.Frame(UIInput{}, gui)
+	u.Frame(UIInput{up: true, from_letters: true, chars: []rune{'w'}}, gui)
+	if u.Focus() != 0 || value != "swo" {
+		t.Errorf("focus = %d, value = %q, want 0 and \"swo\"", u.Focus(), value)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "math/rand"
+
+// Upgrade is one of the choices offered on level up.
+type Upgrade struct {
+	name  string
+	desc  string
+	apply func(p *Player)
+	// changes on top of the weapon data, done again when it is reloaded
+	weapon func(bm *BulletManager)
+}
+
+var upgrades = []*Upgrade{
+	{
+		name: "Power",
+		desc: "+20% damage",
+		weapon: func(bm *BulletManager) {
+			bm.bullet_damage = bm.bullet_damage * 6 / 5
+		},
+	},
+	{
+		name: "Agility",
+		desc: "+10% move speed",
+		apply: func(p *Player) {
+			p.speed *= 1.1
+		},
+	},
+	{
+		name: "Vitality",
+		desc: "+20 max health, fully healed",
+		apply: func(p *Player) {
+			p.max_health += 20
+			p.health = p.max_health
+		},
+	},
+	{
+		name: "Reach",
+		desc: "+25% bullet range",
+		weapon: func(bm *BulletManager) {
+			bm.bullet_lifetime = bm.bullet_lifetime * 5 / 4
+		},
+	},
+}
+
+// Picks count different upgrades at random.
+func RandomUpgrades(count int) []*Upgrade {
+	picked := []*Upgrade{}
+	for _, i := range rand.Perm(len(upgrades)) {
+		if len(picked) == count {
+			break
+		}
+		picked = append(picked, upgrades[i])
+	}
+	return picked
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Builds one of everything that requests textures, so the keys they ask
+// for end up in the missing list of tm.
+func probeReferences(tm *TextureManager) {
+	tm.GetTexture("background")
+	NewPlayer(Vector2{0, 0}, 1, tm)
+	NewBullet(Vector2{0, 0}, Vector2{0, 0}, 1, 0, tm)
+	for _, archetype := range enemy_archetypes {
+		NewEnemy(Vector2{0, 0}, archetype, tm)
+	}
+	NewBoss(Vector2{0, 0}, tm)
+}
+
+// Fails with every key that the game references but the resources dont
+// provide.
+func CheckReferences(tm *TextureManager) error {
+	probeReferences(tm)
+	if missing := tm.Missing(); len(missing) > 0 {
+		return fmt.Errorf("missing resources:\n  %s", strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+// Loads every resource and data file and checks every referenced key,
+// reporting all problems at once instead of stopping at the first.
+func Validate(resources *ResourceManager) []error {
+	errs := []error{}
+	release := resources.Preload(resources.Index())
+	defer release()
+	resources.Wait()
+	for _, err := range resources.Fallbacks() {
+		errs = append(errs, err)
+	}
+
+	tm, err := NewTextureManager(resources, "unknown.png")
+	if err != nil {
+		return append(errs, err)
+	}
+	if err := tm.LoadTextures("."); err != nil {
+		errs = append(errs, err)
+	}
+
+	g := &Game{spawner: NewSpawner()}
+	if err := LoadData(g, resources, "data"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := CheckReferences(tm); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
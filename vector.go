@@ -60,3 +60,31 @@ func (v *Vector2) NormEq() {
 	v.x /= mag
 	v.y /= mag
 }
+
+func (v Vector2) Dot(o Vector2) float64 {
+	return v.x*o.x + v.y*o.y
+}
+
+func (v Vector2) Dist(o Vector2) float64 {
+	return v.Sub(o).Mag()
+}
+
+func (v Vector2) Limit(max float64) Vector2 {
+	mag := v.Mag()
+	if mag > max && mag != 0 {
+		return v.Scale(max / mag)
+	}
+	return v
+}
+
+func (v Vector2) Rotate(angle float64) Vector2 {
+	s, c := math.Sincos(angle)
+	return Vector2{
+		v.x*c - v.y*s,
+		v.x*s + v.y*c,
+	}
+}
+
+func (v Vector2) IsZero() bool {
+	return v.x == 0 && v.y == 0
+}
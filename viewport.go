@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// logical resolution everything is drawn at
+const ScreenWidth = 960
+const ScreenHeight = 600
+
+// Viewport draws the game at a fixed logical resolution into an offscreen
+// buffer, then scales that up by the largest whole factor that fits the
+// window and centers it between black bars.
+type Viewport struct {
+	width  int
+	height int
+	buffer *ebiten.Image
+	scale  float64
+	offset Vector2 // of the buffer on the screen
+}
+
+var viewport = NewViewport(ScreenWidth, ScreenHeight)
+
+func NewViewport(width int, height int) *Viewport {
+	return &Viewport{width: width, height: height, scale: 1}
+}
+
+// Fits the buffer into a screen of the given size. Windows smaller than the
+// logical resolution scale it down unevenly rather than cut it off.
+func (v *Viewport) Fit(screen_width int, screen_height int) {
+	fit := math.Min(float64(screen_width)/float64(v.width), float64(screen_height)/float64(v.height))
+	v.scale = math.Floor(fit)
+	if settings.PixelScale > 0 {
+		v.scale = math.Min(v.scale, float64(settings.PixelScale))
+	}
+	if v.scale < 1 {
+		v.scale = fit
+	}
+	v.offset = Vector2{
+		math.Floor((float64(screen_width) - float64(v.width)*v.scale) / 2),
+		math.Floor((float64(screen_height) - float64(v.height)*v.scale) / 2),
+	}
+}
+
+// The cleared buffer to draw the frame into.
+func (v *Viewport) Buffer() *ebiten.Image {
+	if v.buffer == nil {
+		v.buffer = ebiten.NewImage(v.width, v.height)
+	}
+	v.buffer.Clear()
+	return v.buffer
+}
+
+// Draws the buffer onto the screen.
+func (v *Viewport) Present(screen *ebiten.Image) {
+	screen.Fill(color.Black)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(v.scale, v.scale)
+	op.GeoM.Translate(v.offset.x, v.offset.y)
+	if v.scale != math.Floor(v.scale) {
+		op.Filter = ebiten.FilterLinear
+	}
+	screen.DrawImage(v.buffer, op)
+}
+
+// Converts a position on the screen to the logical resolution.
+func (v *Viewport) ToLogical(p Vector2) Vector2 {
+	return p.Sub(v.offset).Scale(1 / v.scale)
+}
+
+// The mouse cursor in the logical resolution.
+func (v *Viewport) Cursor() Vector2 {
+	cx, cy := ebiten.CursorPosition()
+	return v.ToLogical(Vector2{float64(cx), float64(cy)})
+}
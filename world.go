@@ -0,0 +1,182 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const TileSize = 32
+
+type World struct {
+	width  int
+	height int
+	solid  []bool
+}
+
+func NewWorld(width, height int) *World {
+	return &World{
+		width:  width,
+		height: height,
+		solid:  make([]bool, width*height),
+	}
+}
+
+func (w *World) InBounds(x, y int) bool {
+	return x >= 0 && x < w.width && y >= 0 && y < w.height
+}
+
+func (w *World) Solid(x, y int) bool {
+	// everything outside of the map counts as a wall
+	if !w.InBounds(x, y) {
+		return true
+	}
+	return w.solid[y*w.width+x]
+}
+
+func (w *World) SetSolid(x, y int, solid bool) {
+	if w.InBounds(x, y) {
+		w.solid[y*w.width+x] = solid
+	}
+}
+
+func (w *World) FillRect(x, y, width, height int, solid bool) {
+	for cy := y; cy < y+height; cy++ {
+		for cx := x; cx < x+width; cx++ {
+			w.SetSolid(cx, cy, solid)
+		}
+	}
+}
+
+func (w *World) PosToCell(pos Vector2) (int, int) {
+	return int(math.Floor(pos.x / TileSize)), int(math.Floor(pos.y / TileSize))
+}
+
+func (w *World) CellCenter(x, y int) Vector2 {
+	return Vector2{
+		(float64(x) + 0.5) * TileSize,
+		(float64(y) + 0.5) * TileSize,
+	}
+}
+
+func (w *World) CellRect(x, y int) Rect {
+	return NewRect(Vector2{float64(x) * TileSize, float64(y) * TileSize}, Vector2{TileSize, TileSize})
+}
+
+// Returns true if the rect overlaps any solid tile.
+func (w *World) Collides(r Rect) bool {
+	_, ok := w.firstSolid(r)
+	return ok
+}
+
+// Moves the rect by mov, sliding along solid tiles one axis at a time.
+func (w *World) MoveRect(r *Rect, mov Vector2) {
+	r.pos.x += mov.x
+	if tile, ok := w.firstSolid(*r); ok {
+		r.ResolveX(tile, mov)
+	}
+
+	r.pos.y += mov.y
+	if tile, ok := w.firstSolid(*r); ok {
+		r.ResolveY(tile, mov)
+	}
+}
+
+func (w *World) firstSolid(r Rect) (Rect, bool) {
+	x0, y0 := w.PosToCell(r.pos)
+	x1, y1 := w.PosToCell(r.pos.Add(r.extents).Sub(Vector2{0.001, 0.001}))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if w.Solid(x, y) {
+				return w.CellRect(x, y), true
+			}
+		}
+	}
+	return Rect{}, false
+}
+
+func (w *World) Draw(screen *ebiten.Image) {
+	x0, y0 := w.PosToCell(game.camera.rect.pos)
+	x1, y1 := w.PosToCell(game.camera.rect.pos.Add(game.camera.rect.extents))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if !w.InBounds(x, y) || !w.solid[y*w.width+x] {
+				continue
+			}
+			sp := Vector2{float64(x) * TileSize, float64(y) * TileSize}.Sub(game.camera.rect.pos)
+			vector.DrawFilledRect(screen, float32(sp.x), float32(sp.y), TileSize, TileSize, color.RGBA{25, 25, 30, 255}, false)
+			vector.StrokeRect(screen, float32(sp.x), float32(sp.y), TileSize, TileSize, 1, color.RGBA{70, 70, 80, 255}, false)
+		}
+	}
+}
+
+// Walks the tiles crossed by the segment a-b and reports whether none of
+// them are solid.
+func (w *World) LineOfSight(a, b Vector2) bool {
+	x, y := w.PosToCell(a)
+	ex, ey := w.PosToCell(b)
+	d := b.Sub(a)
+
+	step_x, step_y := 0, 0
+	t_max_x, t_max_y := math.Inf(1), math.Inf(1)
+	t_delta_x, t_delta_y := math.Inf(1), math.Inf(1)
+
+	if d.x > 0 {
+		step_x = 1
+		t_max_x = ((float64(x)+1)*TileSize - a.x) / d.x
+		t_delta_x = TileSize / d.x
+	} else if d.x < 0 {
+		step_x = -1
+		t_max_x = (float64(x)*TileSize - a.x) / d.x
+		t_delta_x = -TileSize / d.x
+	}
+	if d.y > 0 {
+		step_y = 1
+		t_max_y = ((float64(y)+1)*TileSize - a.y) / d.y
+		t_delta_y = TileSize / d.y
+	} else if d.y < 0 {
+		step_y = -1
+		t_max_y = (float64(y)*TileSize - a.y) / d.y
+		t_delta_y = -TileSize / d.y
+	}
+
+	for {
+		if w.Solid(x, y) {
+			return false
+		}
+		if x == ex && y == ey {
+			return true
+		}
+		if t_max_x > 1 && t_max_y > 1 {
+			return true
+		}
+		if t_max_x < t_max_y {
+			t_max_x += t_delta_x
+			x += step_x
+		} else {
+			t_max_y += t_delta_y
+			y += step_y
+		}
+	}
+}
+
+// Like LineOfSight, but for a size by size box centered on the segment a-b.
+// The box is moved along in steps short enough that no tile fits between
+// two of them.
+func (w *World) BoxSight(a, b Vector2, size float64) bool {
+	if size <= 0 {
+		return w.LineOfSight(a, b)
+	}
+	half := Vector2{size / 2, size / 2}
+	d := b.Sub(a)
+	steps := int(math.Ceil(d.Mag()/(math.Min(size, TileSize)/2))) + 1
+	for i := 0; i <= steps; i++ {
+		pos := a.Add(d.Scale(float64(i) / float64(steps)))
+		if w.Collides(NewRect(pos.Sub(half), Vector2{size, size})) {
+			return false
+		}
+	}
+	return true
+}